@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/tree-sitter/go-tree-sitter"
+	"github.com/tree-sitter/tree-sitter-css/bindings/go"
+	"github.com/tree-sitter/tree-sitter-embedded-template/bindings/go"
+	"github.com/tree-sitter/tree-sitter-go/bindings/go"
+	"github.com/tree-sitter/tree-sitter-html/bindings/go"
+	"github.com/tree-sitter/tree-sitter-javascript/bindings/go"
+
+	"go.gopad.dev/go-tree-sitter-highlight"
+)
+
+// grammars are the grammars compiled into tshl by the names their queries can be loaded with.
+var grammars = map[string]*tree_sitter.Language{
+	"css":               tree_sitter.NewLanguage(tree_sitter_css.Language()),
+	"ejs":               tree_sitter.NewLanguage(tree_sitter_embedded_template.Language()),
+	"erb":               tree_sitter.NewLanguage(tree_sitter_embedded_template.Language()),
+	"embedded_template": tree_sitter.NewLanguage(tree_sitter_embedded_template.Language()),
+	"go":                tree_sitter.NewLanguage(tree_sitter_go.Language()),
+	"html":              tree_sitter.NewLanguage(tree_sitter_html.Language()),
+	"javascript":        tree_sitter.NewLanguage(tree_sitter_javascript.Language()),
+}
+
+// languageDefaults are the aliases, globs and interpreters of the compiled in grammars.
+// They are used for languages loaded from a queries/<language> directory, which only provides the name.
+var languageDefaults = map[string]highlight.Language{
+	"css":        {Globs: []string{"*.css"}},
+	"ejs":        {Globs: []string{"*.ejs"}},
+	"erb":        {Globs: []string{"*.erb"}},
+	"go":         {Aliases: []string{"golang"}, Globs: []string{"*.go"}},
+	"html":       {Globs: []string{"*.html", "*.htm"}},
+	"javascript": {Aliases: []string{"js"}, Globs: []string{"*.js", "*.mjs", "*.cjs", "*.jsx"}, Interpreters: []string{"node"}},
+}
+
+// newRegistry returns a registry with the languages of the query directory which have a compiled in grammar.
+func newRegistry(queriesDir string) (*highlight.Registry, error) {
+	languages, err := highlight.LoadLanguages(os.DirFS(queriesDir), grammars)
+	if err != nil {
+		return nil, fmt.Errorf("error loading languages from %q: %w", queriesDir, err)
+	}
+	if len(languages) == 0 {
+		return nil, fmt.Errorf("no languages found in %q", queriesDir)
+	}
+
+	registry := highlight.NewRegistry()
+	for _, language := range languages {
+		if defaults, ok := languageDefaults[language.Name]; ok && len(language.Globs) == 0 {
+			language.Aliases = append(language.Aliases, defaults.Aliases...)
+			language.Globs = defaults.Globs
+			language.Interpreters = defaults.Interpreters
+		}
+		if err = registry.Register(language); err != nil {
+			return nil, err
+		}
+	}
+
+	return registry, nil
+}
@@ -0,0 +1,479 @@
+// Command tshl highlights source code with tree-sitter and writes it to the terminal, as HTML, JSON or SVG.
+//
+// Usage:
+//
+//	tshl [flags] [file ...]
+//
+// The files are read from stdin if no file is passed. The language of each file is detected from its name and first
+// line or set with -language. The grammars of CSS, embedded templates, Go, HTML and JavaScript are compiled in,
+// their queries are loaded from the directory passed with -queries, see [highlight.LoadLanguages] for the layout.
+//
+// The formats are:
+//
+//	ansi           text with ANSI escape sequences for the terminal
+//	html           a <pre><code> element with CSS classes
+//	html-document  a full HTML document with the CSS of the theme
+//	json           the events in the schema of [highlight.EncodeJSON], including the text
+//	svg            an SVG image styled by the theme
+//
+// Part of a file is highlighted with -range, which takes the line numbers start-end, or -byte-range, which takes the
+// byte offsets start-end with an exclusive end.
+//
+// tshl exits with status 1 if a file can't be read or highlighted, the queries of its language fail to load or it has
+// syntax errors in any of its languages, and with status 2 if the flags are invalid. Files with syntax errors are still
+// highlighted.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/tree-sitter/go-tree-sitter"
+
+	"go.gopad.dev/go-tree-sitter-highlight"
+)
+
+const (
+	formatANSI         = "ansi"
+	formatHTML         = "html"
+	formatHTMLDocument = "html-document"
+	formatJSON         = "json"
+	formatSVG          = "svg"
+)
+
+var formats = []string{formatANSI, formatHTML, formatHTMLDocument, formatJSON, formatSVG}
+
+// singleFileFormats are the formats whose output can't be concatenated.
+var singleFileFormats = []string{formatHTMLDocument, formatJSON, formatSVG}
+
+var colorModes = map[string]highlight.ColorMode{
+	"16":        highlight.ColorMode16,
+	"256":       highlight.ColorMode256,
+	"truecolor": highlight.ColorModeTrueColor,
+}
+
+// errInvalidFlags is returned for flags the flag set failed to parse, the flag set already reported the error.
+var errInvalidFlags = errors.New("invalid flags")
+
+// usageError is an error of the flags or arguments.
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string {
+	return e.err.Error()
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// options are the parsed flags.
+type options struct {
+	format    string
+	theme     *highlight.Theme
+	language  string
+	queries   string
+	lines     bool
+	lineRange *highlight.LineRange
+	byteRange *byteRange
+	colorMode highlight.ColorMode
+}
+
+// byteRange is the range of the -byte-range flag, the end is exclusive.
+type byteRange struct {
+	start uint
+	end   uint
+}
+
+// run runs tshl with the arguments and returns the exit status.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	opts, files, err := parseFlags(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if errors.Is(err, errInvalidFlags) {
+		return 2
+	}
+	var usageErr usageError
+	if errors.As(err, &usageErr) {
+		fmt.Fprintf(stderr, "tshl: %s\n", err)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "tshl: %s\n", err)
+		return 1
+	}
+
+	registry, err := newRegistry(opts.queries)
+	if err != nil {
+		fmt.Fprintf(stderr, "tshl: %s\n", err)
+		return 1
+	}
+	defer registry.Close()
+
+	// the JSON output is independent of the theme, so it uses the standard names
+	captureNames := opts.theme.Names()
+	if opts.format == formatJSON {
+		captureNames = highlight.StandardCaptureNames
+	}
+	registry.Configure(captureNames)
+
+	highlighter := highlight.New()
+	defer highlighter.Close()
+
+	out := bufio.NewWriter(stdout)
+	status := 0
+	for _, file := range files {
+		if err = highlightFile(ctx, out, stdin, file, opts, registry, highlighter, captureNames); err != nil {
+			fmt.Fprintf(stderr, "tshl: %s\n", err)
+			status = 1
+		}
+	}
+
+	if err = out.Flush(); err != nil {
+		fmt.Fprintf(stderr, "tshl: error writing output: %s\n", err)
+		status = 1
+	}
+
+	return status
+}
+
+// parseFlags parses the flags and returns the options and the files to highlight.
+func parseFlags(args []string, stderr io.Writer) (*options, []string, error) {
+	flags := flag.NewFlagSet("tshl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: tshl [flags] [file ...]")
+		flags.PrintDefaults()
+	}
+
+	defaultColorMode := "256"
+	if colorTerm := os.Getenv("COLORTERM"); colorTerm == "truecolor" || colorTerm == "24bit" {
+		defaultColorMode = "truecolor"
+	}
+
+	var (
+		opts          options
+		themeFile     string
+		lineRange     string
+		byteRangeFlag string
+		colorMode     string
+	)
+	flags.StringVar(&opts.format, "format", formatANSI, "output `format`: "+strings.Join(formats, ", "))
+	flags.StringVar(&themeFile, "theme", "", "theme `file` in the Helix, VS Code, base16 or TextMate format")
+	flags.StringVar(&opts.language, "language", "", "`name` of the language instead of detecting it")
+	flags.StringVar(&opts.queries, "queries", os.Getenv("TSHL_QUERIES"), "`directory` with a tree-sitter.json or queries/<language>/*.scm, defaults to $TSHL_QUERIES")
+	flags.BoolVar(&opts.lines, "lines", false, "show line numbers")
+	flags.StringVar(&lineRange, "range", "", "only highlight the lines `start-end`, starting at 1")
+	flags.StringVar(&byteRangeFlag, "byte-range", "", "only highlight the bytes `start-end`, starting at 0 with an exclusive end")
+	flags.StringVar(&colorMode, "color", defaultColorMode, "`colors` of the ansi format: 16, 256 or truecolor")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, nil, err
+		}
+		return nil, nil, errInvalidFlags
+	}
+
+	if !slices.Contains(formats, opts.format) {
+		return nil, nil, usageError{fmt.Errorf("unknown format %q, expected one of %s", opts.format, strings.Join(formats, ", "))}
+	}
+
+	var ok bool
+	if opts.colorMode, ok = colorModes[colorMode]; !ok {
+		return nil, nil, usageError{fmt.Errorf("unknown color mode %q, expected 16, 256 or truecolor", colorMode)}
+	}
+
+	if opts.queries == "" {
+		return nil, nil, usageError{errors.New("no query directory, pass -queries or set $TSHL_QUERIES")}
+	}
+
+	if lineRange != "" {
+		ranges, err := highlight.ParseLineRanges(lineRange)
+		if err != nil {
+			return nil, nil, usageError{err}
+		}
+		if len(ranges) != 1 || ranges[0].Start == 0 {
+			return nil, nil, usageError{fmt.Errorf("invalid range %q, expected start-end with line numbers starting at 1", lineRange)}
+		}
+		opts.lineRange = &ranges[0]
+	}
+
+	if byteRangeFlag != "" {
+		if opts.lineRange != nil {
+			return nil, nil, usageError{errors.New("-range and -byte-range can't be combined")}
+		}
+		r, err := parseByteRange(byteRangeFlag)
+		if err != nil {
+			return nil, nil, usageError{err}
+		}
+		opts.byteRange = r
+	}
+
+	files := flags.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	if len(files) > 1 && slices.Contains(singleFileFormats, opts.format) {
+		return nil, nil, usageError{fmt.Errorf("format %q only supports a single file", opts.format)}
+	}
+
+	theme, err := loadTheme(themeFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts.theme = theme
+
+	return &opts, files, nil
+}
+
+// parseByteRange parses the start-end byte range of the -byte-range flag.
+func parseByteRange(s string) (*byteRange, error) {
+	start, end, ok := strings.Cut(s, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid byte range %q, expected start-end", s)
+	}
+	startByte, err := strconv.ParseUint(start, 10, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid byte range %q: %w", s, err)
+	}
+	endByte, err := strconv.ParseUint(end, 10, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid byte range %q: %w", s, err)
+	}
+	if startByte > endByte {
+		return nil, fmt.Errorf("invalid byte range %q, start is after end", s)
+	}
+	return &byteRange{start: uint(startByte), end: uint(endByte)}, nil
+}
+
+// highlightFile highlights the file, or stdin if the file is "-", and writes it in the format of the options.
+func highlightFile(ctx context.Context, w io.Writer, stdin io.Reader, file string, opts *options, registry *highlight.Registry, highlighter *highlight.Highlighter, captureNames []string) error {
+	var (
+		source []byte
+		err    error
+		name   = file
+	)
+	if file == "-" {
+		name = "stdin"
+		source, err = io.ReadAll(stdin)
+		file = ""
+	} else {
+		source, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", name, err)
+	}
+
+	languageName := opts.language
+	if languageName == "" {
+		language, ok := registry.Detect(file, source)
+		if !ok {
+			return fmt.Errorf("%s: unknown language, pass -language", name)
+		}
+		languageName = language.Name
+	}
+
+	cfg, err := registry.Configuration(languageName)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	// the document keeps the trees of all layers, so they are parsed once for highlighting and the syntax check
+	doc := highlight.NewDocument(highlighter, *cfg, registry.InjectionCallback())
+	defer doc.Close()
+	if _, err = doc.Update(ctx, source); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	startByte, endByte := sourceRange(source, opts)
+	var events iter.Seq2[highlight.Event, error]
+	if opts.lineRange != nil || opts.byteRange != nil {
+		events = doc.HighlightRange(ctx, startByte, endByte)
+	} else {
+		events = doc.Highlight(ctx)
+	}
+
+	firstLine := lineNumber(source, startByte)
+	lastLine := lineNumber(source, max(endByte, startByte+1)-1)
+	if err = render(w, events, name, source, opts, captureNames, firstLine, lastLine); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	if point, ok := findSyntaxError(doc.Trees()); ok {
+		return fmt.Errorf("%s:%d:%d: syntax error", name, point.Row+1, point.Column+1)
+	}
+
+	return nil
+}
+
+// render writes the events in the format of the options.
+// firstLine and lastLine are the numbers of the first and last highlighted line.
+func render(w io.Writer, events iter.Seq2[highlight.Event, error], name string, source []byte, opts *options, captureNames []string, firstLine uint, lastLine uint) error {
+	switch opts.format {
+	case formatANSI:
+		if opts.lines {
+			w = &lineNumberWriter{
+				w:      w,
+				number: firstLine,
+				width:  len(fmt.Sprint(lastLine)),
+			}
+		}
+		return highlight.NewTerminalRender(opts.colorMode).Render(w, events, source, opts.theme.StyleCallback(captureNames))
+	case formatHTML, formatHTMLDocument:
+		r := highlight.NewHTMLRender()
+		r.FirstLineNumber = firstLine
+		if opts.lines {
+			r.LineMode = highlight.LineModeTable
+			r.LineNumbers = true
+		}
+
+		if opts.format == formatHTMLDocument {
+			return r.RenderThemeDocument(w, events, filepath.Base(name), source, captureNames, opts.theme)
+		}
+
+		// tables can't be placed in a <pre> element
+		start, end := "<pre><code>", "</code></pre>\n"
+		if r.LineMode == highlight.LineModeTable {
+			start, end = "", "\n"
+		}
+		if _, err := io.WriteString(w, start); err != nil {
+			return err
+		}
+		if err := r.Render(w, events, source, r.ThemeAttributeCallback(opts.theme, captureNames)); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, end)
+		return err
+	case formatJSON:
+		return highlight.EncodeJSON(w, events, highlight.JSONOptions{CaptureNames: captureNames, Source: source})
+	case formatSVG:
+		return renderSVG(w, events, source, opts.theme, captureNames, opts.lines)
+	default:
+		return fmt.Errorf("unknown format %q", opts.format)
+	}
+}
+
+// sourceRange returns the byte range of the source code to highlight, the whole source code without a range flag.
+func sourceRange(source []byte, opts *options) (uint, uint) {
+	switch {
+	case opts.lineRange != nil:
+		return lineOffset(source, opts.lineRange.Start-1), lineOffset(source, opts.lineRange.End)
+	case opts.byteRange != nil:
+		end := min(opts.byteRange.end, uint(len(source)))
+		return min(opts.byteRange.start, end), end
+	default:
+		return 0, uint(len(source))
+	}
+}
+
+// lineOffset returns the byte offset of the start of the zero-based row, or the length of the source code if it has
+// fewer rows.
+func lineOffset(source []byte, row uint) uint {
+	var offset uint
+	for range row {
+		i := bytes.IndexByte(source[offset:], '\n')
+		if i == -1 {
+			return uint(len(source))
+		}
+		offset += uint(i) + 1
+	}
+	return offset
+}
+
+// lineNumber returns the one-based number of the line containing the byte offset.
+func lineNumber(source []byte, offset uint) uint {
+	return uint(bytes.Count(source[:offset], []byte("\n"))) + 1
+}
+
+// findSyntaxError returns the position of the first error or missing node in the syntax trees of all language layers.
+func findSyntaxError(trees []*tree_sitter.Tree) (tree_sitter.Point, bool) {
+	var first *tree_sitter.Node
+	for _, tree := range trees {
+		root := tree.RootNode()
+		if node, ok := firstSyntaxError(&root); ok && (first == nil || node.StartByte() < first.StartByte()) {
+			first = node
+		}
+	}
+	if first == nil {
+		return tree_sitter.Point{}, false
+	}
+	return first.StartPosition(), true
+}
+
+// firstSyntaxError returns the first error or missing node of the syntax tree.
+func firstSyntaxError(node *tree_sitter.Node) (*tree_sitter.Node, bool) {
+	for {
+		if node.IsError() || node.IsMissing() {
+			return node, true
+		}
+		if !node.HasError() {
+			return nil, false
+		}
+
+		// descend into the first child containing an error
+		var next *tree_sitter.Node
+		for i := range node.ChildCount() {
+			if child := node.Child(i); child != nil && (child.HasError() || child.IsMissing()) {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			return node, true
+		}
+		node = next
+	}
+}
+
+// lineNumberWriter prefixes each line written by the [highlight.TerminalRender] with its line number.
+// The renderer resets the style at the end of each line, so the line numbers are not styled by the highlights.
+type lineNumberWriter struct {
+	w       io.Writer
+	number  uint
+	width   int
+	midLine bool
+}
+
+func (l *lineNumberWriter) Write(p []byte) (int, error) {
+	var n int
+	for len(p) > 0 {
+		if !l.midLine {
+			if _, err := fmt.Fprintf(l.w, "\x1b[2m%*d │\x1b[0m ", l.width, l.number); err != nil {
+				return n, err
+			}
+			l.number++
+			l.midLine = true
+		}
+
+		i := bytes.IndexByte(p, '\n')
+		if i == -1 {
+			m, err := l.w.Write(p)
+			return n + m, err
+		}
+
+		m, err := l.w.Write(p[:i+1])
+		n += m
+		if err != nil {
+			return n, err
+		}
+		p = p[i+1:]
+		l.midLine = false
+	}
+	return n, nil
+}
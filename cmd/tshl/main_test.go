@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.gopad.dev/go-tree-sitter-highlight"
+)
+
+const testQueries = "../../testdata"
+
+func TestRun(t *testing.T) {
+	source := "package main\n\n// hi\nfunc main() {}\n"
+
+	tests := []struct {
+		name     string
+		args     []string
+		stdin    string
+		status   int
+		contains []string
+		stderr   string
+	}{
+		{
+			name:     "ansi",
+			args:     []string{"-queries", testQueries, "-language", "go", "-color", "16"},
+			stdin:    source,
+			contains: []string{"\x1b[1;35mpackage\x1b[0m", "\x1b[3;90m// hi\x1b[0m"},
+		},
+		{
+			name:     "ansi line numbers and range",
+			args:     []string{"-queries", testQueries, "-language", "go", "-lines", "-range", "3-4"},
+			stdin:    source,
+			contains: []string{"\x1b[2m3 │\x1b[0m ", "\x1b[2m4 │\x1b[0m "},
+		},
+		{
+			name:     "ansi line numbers and byte range",
+			args:     []string{"-queries", testQueries, "-language", "go", "-color", "16", "-lines", "-byte-range", "14-19"},
+			stdin:    source,
+			contains: []string{"\x1b[2m3 │\x1b[0m \x1b[3;90m// hi\x1b[0m"},
+		},
+		{
+			name:     "html",
+			args:     []string{"-queries", testQueries, "-language", "golang", "-format", "html"},
+			stdin:    source,
+			contains: []string{`<pre><code><span class="hl-keyword">package</span>`, "</code></pre>\n"},
+		},
+		{
+			name:     "html line numbers",
+			args:     []string{"-queries", testQueries, "-language", "go", "-format", "html", "-lines", "-range", "3-3"},
+			stdin:    source,
+			contains: []string{`<tr id="L3"><td class="hl-line-number"><a href="#L3">3</a></td><td class="hl-line"><span class="hl-comment">// hi</span></td></tr>`},
+		},
+		{
+			name:     "html document",
+			args:     []string{"-queries", testQueries, "-format", "html-document", "../../testdata/test.go"},
+			contains: []string{"<title>test.go</title>", ".hl-keyword{color:#cd00cd;font-weight:bold;}"},
+		},
+		{
+			name:     "svg",
+			args:     []string{"-queries", testQueries, "-language", "go", "-format", "svg", "-lines"},
+			stdin:    "a := \"<b>\"\n",
+			contains: []string{`<svg xmlns="http://www.w3.org/2000/svg" width="141.2" height="52"`, `<tspan fill="#00cd00">&#34;&lt;b&gt;&#34;</tspan>`},
+		},
+		{
+			name:   "syntax error",
+			args:   []string{"-queries", testQueries, "-language", "go"},
+			stdin:  "package main\n\nfunc main( {\n",
+			status: 1,
+			stderr: "tshl: stdin:3:1: syntax error",
+		},
+		{
+			name:   "syntax error in injected language",
+			args:   []string{"-queries", testQueries, "-language", "html"},
+			stdin:  "<p>a</p>\n<script>\nlet a = ;\n</script>\n",
+			status: 1,
+			stderr: "tshl: stdin:3:7: syntax error",
+		},
+		{
+			name:   "unknown language",
+			args:   []string{"-queries", testQueries},
+			stdin:  source,
+			status: 1,
+			stderr: "stdin: unknown language",
+		},
+		{
+			name:   "unknown format",
+			args:   []string{"-queries", testQueries, "-format", "pdf"},
+			status: 2,
+			stderr: `unknown format "pdf"`,
+		},
+		{
+			name:   "invalid range",
+			args:   []string{"-queries", testQueries, "-range", "0-3"},
+			status: 2,
+			stderr: `invalid range "0-3"`,
+		},
+		{
+			name:   "invalid byte range",
+			args:   []string{"-queries", testQueries, "-byte-range", "5-2"},
+			status: 2,
+			stderr: `invalid byte range "5-2"`,
+		},
+		{
+			name:   "range and byte range",
+			args:   []string{"-queries", testQueries, "-range", "1-2", "-byte-range", "0-2"},
+			status: 2,
+			stderr: "-range and -byte-range can't be combined",
+		},
+		{
+			name:   "multiple files",
+			args:   []string{"-queries", testQueries, "-format", "svg", "a.go", "b.go"},
+			status: 2,
+			stderr: `format "svg" only supports a single file`,
+		},
+		{
+			name:   "missing queries",
+			args:   []string{"-queries", t.TempDir()},
+			status: 1,
+			stderr: "error loading languages",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			status := run(context.Background(), tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+			assert.Equal(t, tt.status, status, stderr.String())
+			for _, s := range tt.contains {
+				assert.Contains(t, stdout.String(), s)
+			}
+			assert.Contains(t, stderr.String(), tt.stderr)
+		})
+	}
+}
+
+func TestRun_JSON(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	status := run(context.Background(), []string{"-queries", testQueries, "-format", "json", "../../testdata/test.go"}, nil, &stdout, &stderr)
+	require.Equal(t, 0, status, stderr.String())
+
+	events, captureNames, err := highlight.DecodeJSON(&stdout)
+	require.NoError(t, err)
+	assert.Equal(t, highlight.StandardCaptureNames, captureNames)
+	assert.Equal(t, highlight.EventLayerStart{LanguageName: "go"}, events[0])
+}
+
+func TestRun_QueryError(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "queries", "go"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "queries", "go", "highlights.scm"), []byte("(unknown_node) @keyword"), 0o644))
+
+	var stdout, stderr bytes.Buffer
+	status := run(context.Background(), []string{"-queries", dir, "-language", "go"}, strings.NewReader("package main\n"), &stdout, &stderr)
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stderr.String(), `error loading language "go"`)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"iter"
+	"math"
+	"strconv"
+	"strings"
+
+	"go.gopad.dev/go-tree-sitter-highlight"
+)
+
+// The layout of the SVG images in pixels. The character width is the usual width of monospace fonts of 0.6em.
+const (
+	svgFontSize   = 14
+	svgCharWidth  = 8.4
+	svgLineHeight = 20
+	svgBaseline   = 15
+	svgPadding    = 16
+	svgTabWidth   = 4
+)
+
+// svgToken is a token of a line with its text and resolved style.
+type svgToken struct {
+	text   string
+	column int
+	width  int
+	style  highlight.Style
+}
+
+type svgLine struct {
+	number uint
+	tokens []svgToken
+}
+
+// renderSVG renders the source code as an SVG image with a <text> element for each line and a <tspan> for each token.
+// Backgrounds are drawn as rectangles behind the text. Every character is counted as one column, wide characters
+// overlap the following text.
+func renderSVG(w io.Writer, events iter.Seq2[highlight.Event, error], source []byte, theme *highlight.Theme, captureNames []string, lineNumbers bool) error {
+	callback := theme.StyleCallback(captureNames)
+
+	var (
+		lines   []svgLine
+		columns int
+	)
+	for line, err := range highlight.Lines(events, source) {
+		if err != nil {
+			return fmt.Errorf("error while rendering: %w", err)
+		}
+
+		l := svgLine{number: line.Row + 1}
+		var column int
+		for _, token := range line.Tokens {
+			var style highlight.Style
+			for _, h := range token.Highlights {
+				style = callback(h, token.LanguageName).Inherit(style)
+			}
+
+			text, end := expandTabs(source[token.StartByte:token.EndByte], column)
+			l.tokens = append(l.tokens, svgToken{
+				text:   text,
+				column: column,
+				width:  end - column,
+				style:  style.Inherit(callback(highlight.DefaultHighlight, token.LanguageName)),
+			})
+			column = end
+		}
+		columns = max(columns, column)
+		lines = append(lines, l)
+	}
+
+	// the line numbers are right aligned in a gutter of the width of the largest number and two columns of space
+	var gutter int
+	if lineNumbers && len(lines) > 0 {
+		gutter = len(strconv.FormatUint(uint64(lines[len(lines)-1].number), 10)) + 2
+	}
+
+	width := 2*svgPadding + float64(gutter+columns)*svgCharWidth
+	height := 2*svgPadding + len(lines)*svgLineHeight
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%s" height="%d" viewBox="0 0 %s %d">`+"\n", formatFloat(width), height, formatFloat(width), height)
+	if theme.Default.Background.IsSet() {
+		fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", svgColor(theme.Default.Background))
+	}
+	fmt.Fprintf(&b, `<g font-family="monospace" font-size="%d" xml:space="preserve" style="white-space:pre"%s>`+"\n", svgFontSize, svgStyleAttributes(theme.Default))
+
+	for i, line := range lines {
+		top := svgPadding + i*svgLineHeight
+		y := top + svgBaseline
+
+		for _, token := range line.tokens {
+			if token.style.Background.IsSet() && token.style.Background != theme.Default.Background {
+				fmt.Fprintf(&b, `<rect x="%s" y="%d" width="%s" height="%d" fill="%s"/>`+"\n",
+					formatFloat(svgPadding+float64(gutter+token.column)*svgCharWidth), top,
+					formatFloat(float64(token.width)*svgCharWidth), svgLineHeight, svgColor(token.style.Background),
+				)
+			}
+		}
+
+		if gutter > 0 {
+			fmt.Fprintf(&b, `<text x="%s" y="%d" text-anchor="end" fill-opacity="0.5">%d</text>`+"\n", formatFloat(svgPadding+float64(gutter-2)*svgCharWidth), y, line.number)
+		}
+
+		if len(line.tokens) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, `<text x="%s" y="%d">`, formatFloat(svgPadding+float64(gutter)*svgCharWidth), y)
+		for _, token := range line.tokens {
+			attributes := svgStyleAttributes(token.style)
+			if attributes == "" {
+				_ = xml.EscapeText(&b, []byte(token.text))
+				continue
+			}
+			fmt.Fprintf(&b, "<tspan%s>", attributes)
+			_ = xml.EscapeText(&b, []byte(token.text))
+			b.WriteString("</tspan>")
+		}
+		b.WriteString("</text>\n")
+	}
+
+	b.WriteString("</g>\n</svg>\n")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// expandTabs returns the text with tabs expanded to spaces and carriage returns removed and the column after the text.
+func expandTabs(text []byte, column int) (string, int) {
+	var b strings.Builder
+	for _, c := range string(text) {
+		switch c {
+		case '\t':
+			n := svgTabWidth - column%svgTabWidth
+			b.WriteString(strings.Repeat(" ", n))
+			column += n
+		case '\r':
+		default:
+			b.WriteRune(c)
+			column++
+		}
+	}
+	return b.String(), column
+}
+
+// svgStyleAttributes returns the presentation attributes of the style without the background, starting with a space.
+func svgStyleAttributes(style highlight.Style) string {
+	var b strings.Builder
+	if style.Foreground.IsSet() {
+		b.WriteString(` fill="` + svgColor(style.Foreground) + `"`)
+	}
+	if style.Bold {
+		b.WriteString(` font-weight="bold"`)
+	}
+	if style.Italic {
+		b.WriteString(` font-style="italic"`)
+	}
+	switch {
+	case style.Underline && style.Strikethrough:
+		b.WriteString(` text-decoration="underline line-through"`)
+	case style.Underline:
+		b.WriteString(` text-decoration="underline"`)
+	case style.Strikethrough:
+		b.WriteString(` text-decoration="line-through"`)
+	}
+	return b.String()
+}
+
+// svgColor returns the color as #rrggbb. Palette colors are converted using the xterm default palette.
+func svgColor(color highlight.Color) string {
+	return highlight.RGBColor(color.RGB()).String()
+}
+
+// formatFloat formats a coordinate with at most two decimals.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(math.Round(f*100)/100, 'f', -1, 64)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"go.gopad.dev/go-tree-sitter-highlight"
+	"go.gopad.dev/go-tree-sitter-highlight/theme"
+)
+
+// defaultTheme is used if no theme is passed. It only uses the 16 basic ANSI colors, so terminals show it in their own palette.
+var defaultTheme = &highlight.Theme{
+	Name: "default",
+	Styles: map[string]highlight.Style{
+		"attribute":             {Foreground: highlight.IndexedColor(3)},
+		"boolean":               {Foreground: highlight.IndexedColor(5)},
+		"comment":               {Foreground: highlight.IndexedColor(8), Italic: true},
+		"constant":              {Foreground: highlight.IndexedColor(5)},
+		"constant.builtin":      {Foreground: highlight.IndexedColor(5)},
+		"constructor":           {Foreground: highlight.IndexedColor(3)},
+		"error":                 {Foreground: highlight.IndexedColor(1), Underline: true},
+		"escape":                {Foreground: highlight.IndexedColor(6)},
+		"function":              {Foreground: highlight.IndexedColor(4)},
+		"function.builtin":      {Foreground: highlight.IndexedColor(4), Bold: true},
+		"keyword":               {Foreground: highlight.IndexedColor(5), Bold: true},
+		"markup.bold":           {Bold: true},
+		"markup.heading":        {Foreground: highlight.IndexedColor(4), Bold: true},
+		"markup.italic":         {Italic: true},
+		"markup.link":           {Foreground: highlight.IndexedColor(6), Underline: true},
+		"markup.strikethrough":  {Strikethrough: true},
+		"module":                {Foreground: highlight.IndexedColor(3)},
+		"number":                {Foreground: highlight.IndexedColor(5)},
+		"operator":              {Foreground: highlight.IndexedColor(6)},
+		"property":              {Foreground: highlight.IndexedColor(6)},
+		"punctuation.special":   {Foreground: highlight.IndexedColor(6)},
+		"string":                {Foreground: highlight.IndexedColor(2)},
+		"string.escape":         {Foreground: highlight.IndexedColor(6)},
+		"string.regexp":         {Foreground: highlight.IndexedColor(1)},
+		"string.special":        {Foreground: highlight.IndexedColor(6)},
+		"string.special.symbol": {Foreground: highlight.IndexedColor(3)},
+		"tag":                   {Foreground: highlight.IndexedColor(4)},
+		"type":                  {Foreground: highlight.IndexedColor(3)},
+		"type.builtin":          {Foreground: highlight.IndexedColor(3), Bold: true},
+		"variable.builtin":      {Foreground: highlight.IndexedColor(1)},
+		"variable.parameter":    {Foreground: highlight.IndexedColor(1)},
+	},
+}
+
+// loadTheme parses the theme file or returns the default theme if the file name is empty.
+func loadTheme(fileName string) (*highlight.Theme, error) {
+	if fileName == "" {
+		return defaultTheme, nil
+	}
+
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading theme: %w", err)
+	}
+
+	t, err := theme.Parse(fileName, data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing theme %q: %w", fileName, err)
+	}
+	return t, nil
+}
@@ -104,6 +104,7 @@ func NewConfiguration(language *tree_sitter.Language, languageName string, highl
 
 	combinedInjectionsQuery, err := tree_sitter.NewQuery(language, string(injectionQuery))
 	if err != nil {
+		query.Close()
 		return nil, fmt.Errorf("error creating combined injections query: %w", err)
 	}
 	var hasCombinedQueries bool
@@ -119,17 +120,16 @@ func NewConfiguration(language *tree_sitter.Language, languageName string, highl
 		}
 	}
 	if !hasCombinedQueries {
+		combinedInjectionsQuery.Close()
 		combinedInjectionsQuery = nil
 	}
 
-	nonLocalVariablePatterns := make([]bool, 0)
+	nonLocalVariablePatterns := make([]bool, query.PatternCount())
 	for i := range query.PatternCount() {
 		predicates := query.PropertyPredicates(i)
-		if slices.ContainsFunc(predicates, func(predicate tree_sitter.PropertyPredicate) bool {
+		nonLocalVariablePatterns[i] = slices.ContainsFunc(predicates, func(predicate tree_sitter.PropertyPredicate) bool {
 			return !predicate.Positive && predicate.Property.Key == captureLocal
-		}) {
-			nonLocalVariablePatterns = append(nonLocalVariablePatterns, true)
-		}
+		})
 	}
 
 	var (
@@ -195,6 +195,15 @@ type Configuration struct {
 	LocalRefCaptureIndex          *uint
 }
 
+// Close releases the queries of the configuration.
+// The configuration and all copies of it must not be used afterwards.
+func (c *Configuration) Close() {
+	c.Query.Close()
+	if c.CombinedInjectionsQuery != nil {
+		c.CombinedInjectionsQuery.Close()
+	}
+}
+
 // Names gets a slice containing all the highlight names used in the configuration.
 func (c *Configuration) Names() []string {
 	return c.Query.CaptureNames()
@@ -28,9 +28,12 @@ This returns a [iter.Seq2[Event, error]] that you can iterate over to get the hi
 		log.Fatal(err)
 	}
 
+	defer cfg.Close()
+
 	cfg.Configure(captureNames)
 
 	highlighter := New()
+	defer highlighter.Close()
 	events := highlighter.Highlight(context.Background(), cfg, source, func(name string) *Configuration {
 		return nil
 	})
@@ -54,5 +57,81 @@ This returns a [iter.Seq2[Event, error]] that you can iterate over to get the hi
 			}
 		}
 	}
+
+# Registry
+
+A [highlight.Registry] maps names, aliases, file globs and shebang interpreters to configurations.
+It detects the language of a file and resolves injected languages.
+
+	registry := NewRegistry()
+	err := registry.Register(Language{
+		Name:         "javascript",
+		Aliases:      []string{"js"},
+		Globs:        []string{"*.js", "*.mjs"},
+		Interpreters: []string{"node"},
+		Load: func() (*Configuration, error) {
+			return NewConfiguration(jsLanguage, "javascript", jsHighlightsQuery, jsInjectionQuery, jsLocalsQuery)
+		},
+	})
+	registry.Configure(captureNames)
+
+	language, ok := registry.Detect("main.js", source)
+	cfg, err := registry.Configuration(language.Name)
+	events := highlighter.Highlight(ctx, *cfg, source, registry.InjectionCallback())
+
+Configurations are compiled the first time they are used, including through an injection, and cached afterwards.
+The registry owns them, so [highlight.Registry.Close] must only be called once all highlighting is done.
+
+[highlight.LoadLanguages] reads the languages of a tree-sitter.json file or a queries/<language>/*.scm directory layout
+from an [fs.FS], so the queries can be embedded with an [embed.FS].
+
+	languages, err := LoadLanguages(os.DirFS("grammars"), map[string]*tree_sitter.Language{
+		"javascript": tree_sitter.NewLanguage(tree_sitter_javascript.Language()),
+	})
+
+# Themes
+
+A [highlight.Theme] maps capture names to styles. Configure the configurations with the names of the theme
+and pass the theme to a renderer.
+
+	cfg.Configure(theme.Names())
+
+	err := NewTerminalRender(ColorModeTrueColor).Render(os.Stdout, events, source, theme.StyleCallback(theme.Names()))
+
+The [highlight.HTMLRender] renders the theme as CSS classes, optionally scoped to a container
+and switching between a light and a dark theme with the prefers-color-scheme media query.
+
+	r := NewHTMLRender()
+	r.CSSScope = ".code"
+	err := r.RenderColorSchemeCSS(w, lightTheme, darkTheme, captureNames)
+	err = r.Render(w, events, source, r.ThemesAttributeCallback([]*Theme{lightTheme, darkTheme}, captureNames))
+
+# JSON
+
+[highlight.EncodeJSON] and [highlight.EncodeNDJSON] write the events in a versioned JSON schema for other languages
+and services, [highlight.EncodeSpansJSON] writes the spans collected by [highlight.CollectSpans].
+The capture names and optionally the source text are included, [highlight.DecodeJSON] and [highlight.DecodeNDJSON] read them back.
+
+	err := EncodeNDJSON(w, events, JSONOptions{CaptureNames: captureNames, Source: source})
+
+	captureNames, events, err := DecodeNDJSON(r)
+
+# Incremental highlighting
+
+Editors which highlight the same source code after every change can use a [highlight.Document] instead.
+It keeps the syntax trees of all language layers and reparses them incrementally after an edit.
+
+	doc := NewDocument(New(), *cfg, injectionCallback)
+	defer doc.Close()
+
+	changedRanges, err := doc.Update(ctx, source)
+
+	// apply the edit to the source and the document
+	doc.Edit(edit)
+	changedRanges, err = doc.Update(ctx, newSource)
+
+	events := doc.Highlight(ctx)
+
+[highlight.Document.Trees] returns the syntax trees of all language layers, e.g. to find syntax errors in injected languages.
 */
 package highlight
@@ -0,0 +1,322 @@
+package highlight
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"iter"
+	"slices"
+
+	"github.com/tree-sitter/go-tree-sitter"
+)
+
+// ErrPendingEdits is returned when a [Document] is highlighted after [Document.Edit] without calling [Document.Update].
+var ErrPendingEdits = errors.New("document has pending edits")
+
+// NewDocument returns a new Document for the given configuration.
+// Call [Document.Update] with the source code to parse the document before highlighting it.
+func NewDocument(highlighter *Highlighter, cfg Configuration, injectionCallback InjectionCallback) *Document {
+	return &Document{
+		Highlighter:       highlighter,
+		Config:            cfg,
+		InjectionCallback: injectionCallback,
+	}
+}
+
+// Document is a source code document which keeps the syntax trees of the root layer and each injection layer.
+// This allows it to reparse the source code incrementally after an edit and report which ranges need to be highlighted again.
+// The trees are also available with [Document.Trees], e.g. to report syntax errors without parsing the source code again.
+// Like the [Highlighter] it uses, a Document is not thread-safe.
+type Document struct {
+	Highlighter       *Highlighter
+	Config            Configuration
+	InjectionCallback InjectionCallback
+
+	source []byte
+	layers []*documentLayer
+	edited []tree_sitter.Range
+}
+
+type documentLayer struct {
+	config Configuration
+	depth  uint
+	ranges []tree_sitter.Range
+	tree   *tree_sitter.Tree
+}
+
+// Source returns the source code the document was last updated with.
+func (d *Document) Source() []byte {
+	return d.source
+}
+
+// Trees returns the syntax trees of the root layer and each injection layer of the last [Document.Update],
+// the root layer first. The trees are owned by the document and only valid until the next update or [Document.Close],
+// so they must not be closed or edited by the caller. Use [tree_sitter.Tree.Clone] to keep a tree longer.
+func (d *Document) Trees() []*tree_sitter.Tree {
+	trees := make([]*tree_sitter.Tree, 0, len(d.layers))
+	for _, layer := range d.layers {
+		trees = append(trees, layer.tree)
+	}
+	return trees
+}
+
+// Edit applies an edit to the syntax trees of the document.
+// Multiple edits can be applied before calling [Document.Update] with the edited source code.
+func (d *Document) Edit(edit tree_sitter.InputEdit) {
+	for _, layer := range d.layers {
+		layer.tree.Edit(&edit)
+	}
+
+	for i, r := range d.edited {
+		d.edited[i] = editRange(r, edit)
+	}
+	d.edited = append(d.edited, tree_sitter.Range{
+		StartByte:  edit.StartByte,
+		StartPoint: edit.StartPosition,
+		EndByte:    edit.NewEndByte,
+		EndPoint:   edit.NewEndPosition,
+	})
+}
+
+// Update reparses the document with the given source code. The syntax trees of the previous version are reused,
+// so all edits made to the source code since the last update must have been applied with [Document.Edit] first.
+//
+// Update returns the sorted, non overlapping byte ranges whose highlighting might have changed.
+// On the first update this is the whole document.
+func (d *Document) Update(ctx context.Context, source []byte) ([]tree_sitter.Range, error) {
+	oldLayers := d.layers
+	usedLayers := make([]bool, len(oldLayers))
+
+	changedRanges := slices.Clone(d.edited)
+	var layers []*documentLayer
+
+	queue := []highlightQueueItem{
+		{
+			config: d.Config,
+			depth:  0,
+			ranges: []tree_sitter.Range{documentRange},
+		},
+	}
+	for len(queue) > 0 {
+		var item highlightQueueItem
+		item, queue = queue[0], queue[1:]
+
+		var oldTree *tree_sitter.Tree
+		if i := findDocumentLayer(oldLayers, usedLayers, item); i != -1 {
+			usedLayers[i] = true
+			oldTree = oldLayers[i].tree
+		}
+
+		tree, err := d.Highlighter.parseTree(ctx, item.config, source, item.ranges, oldTree)
+		if err != nil {
+			for _, layer := range layers {
+				layer.tree.Close()
+			}
+			return nil, err
+		}
+		if tree == nil {
+			continue
+		}
+
+		if oldTree != nil {
+			changedRanges = append(changedRanges, oldTree.ChangedRanges(tree)...)
+		} else {
+			changedRanges = append(changedRanges, item.ranges...)
+		}
+
+		layer := &documentLayer{
+			config: item.config,
+			depth:  item.depth,
+			ranges: item.ranges,
+			tree:   tree,
+		}
+		layers = append(layers, layer)
+		queue = append(queue, d.injections(layer, source)...)
+	}
+
+	for i, layer := range oldLayers {
+		if !usedLayers[i] {
+			changedRanges = append(changedRanges, layer.tree.IncludedRanges()...)
+		}
+		layer.tree.Close()
+	}
+
+	d.source = source
+	d.layers = layers
+	d.edited = nil
+
+	return mergeRanges(changedRanges, source), nil
+}
+
+// Highlight highlights the document using the syntax trees of the last [Document.Update].
+// The function returns an [iter.Seq2[Event, error]] that yields the highlight events or an error.
+func (d *Document) Highlight(ctx context.Context) iter.Seq2[Event, error] {
+	if len(d.edited) > 0 {
+		return func(yield func(Event, error) bool) {
+			yield(nil, ErrPendingEdits)
+		}
+	}
+
+	return d.Highlighter.highlight(ctx, d.Config, d.source, d.InjectionCallback, d.parseLayer, 0, uint(len(d.source)))
+}
+
+// HighlightRange highlights the part of the document between startByte and endByte using the syntax trees of the last [Document.Update].
+// See [Highlighter.HighlightRange] for details.
+func (d *Document) HighlightRange(ctx context.Context, startByte uint, endByte uint) iter.Seq2[Event, error] {
+	if len(d.edited) > 0 {
+		return func(yield func(Event, error) bool) {
+			yield(nil, ErrPendingEdits)
+		}
+	}
+
+	endByte = min(endByte, uint(len(d.source)))
+	startByte = min(startByte, endByte)
+	return d.Highlighter.highlight(ctx, d.Config, d.source, d.InjectionCallback, d.parseLayer, startByte, endByte)
+}
+
+// Close releases the syntax trees of the document.
+func (d *Document) Close() {
+	for _, layer := range d.layers {
+		layer.tree.Close()
+	}
+	d.layers = nil
+}
+
+// parseLayer returns a copy of the syntax tree of a layer from the last update, so the iterator can release it independently.
+// Layers which are unknown to the document are parsed from scratch.
+func (d *Document) parseLayer(ctx context.Context, config Configuration, depth uint, ranges []tree_sitter.Range) (*tree_sitter.Tree, error) {
+	for _, layer := range d.layers {
+		if layer.config.LanguageName == config.LanguageName && layer.depth == depth && slices.Equal(layer.ranges, ranges) {
+			return layer.tree.Clone(), nil
+		}
+	}
+
+	return d.Highlighter.parseTree(ctx, config, d.source, ranges, nil)
+}
+
+// injections returns all combined and regular injections of a layer.
+func (d *Document) injections(layer *documentLayer, source []byte) []highlightQueueItem {
+	cursor := d.Highlighter.popCursor()
+	defer d.Highlighter.pushCursor(cursor)
+
+	queue := combinedInjections(cursor, layer.tree, source, d.Config.LanguageName, d.InjectionCallback, layer.config, layer.depth, layer.ranges)
+
+	matches := cursor.Matches(layer.config.Query, layer.tree.RootNode(), source)
+	for {
+		match := matches.Next()
+		if match == nil {
+			break
+		}
+		if match.PatternIndex >= layer.config.LocalsPatternIndex {
+			continue
+		}
+
+		languageName, contentNode, includeChildren := injectionForMatch(layer.config, d.Config.LanguageName, layer.config.Query, *match, source)
+		if languageName == "" || contentNode == nil {
+			continue
+		}
+
+		config := d.InjectionCallback(languageName)
+		if config == nil {
+			continue
+		}
+
+		ranges := intersectRanges(layer.ranges, []tree_sitter.Node{*contentNode}, includeChildren)
+		if len(ranges) > 0 {
+			queue = append(queue, highlightQueueItem{
+				config: *config,
+				depth:  layer.depth + 1,
+				ranges: ranges,
+			})
+		}
+	}
+
+	return queue
+}
+
+// findDocumentLayer returns the index of the first unused layer with the same language and depth as the item
+// which overlaps with the item's ranges or -1 if there is none.
+func findDocumentLayer(layers []*documentLayer, used []bool, item highlightQueueItem) int {
+	start, end := item.ranges[0].StartByte, item.ranges[len(item.ranges)-1].EndByte
+	for i, layer := range layers {
+		if used[i] || layer.depth != item.depth || layer.config.LanguageName != item.config.LanguageName {
+			continue
+		}
+
+		// the included ranges of the tree have already been adjusted to the edits
+		ranges := layer.tree.IncludedRanges()
+		if len(ranges) == 0 {
+			continue
+		}
+		if ranges[0].StartByte <= end && start <= ranges[len(ranges)-1].EndByte {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// mergeRanges sorts the ranges, clamps them to the source and merges overlapping ranges.
+func mergeRanges(ranges []tree_sitter.Range, source []byte) []tree_sitter.Range {
+	slices.SortFunc(ranges, func(a, b tree_sitter.Range) int {
+		return cmp.Compare(a.StartByte, b.StartByte)
+	})
+
+	var result []tree_sitter.Range
+	for _, r := range ranges {
+		if r.StartByte > uint(len(source)) {
+			continue
+		}
+		if r.EndByte > uint(len(source)) {
+			r.EndByte = uint(len(source))
+			r.EndPoint = pointAt(source, r.EndByte)
+		}
+
+		if len(result) > 0 && r.StartByte <= result[len(result)-1].EndByte {
+			last := &result[len(result)-1]
+			if r.EndByte > last.EndByte {
+				last.EndByte = r.EndByte
+				last.EndPoint = r.EndPoint
+			}
+			continue
+		}
+		result = append(result, r)
+	}
+
+	return result
+}
+
+// editRange adjusts the range to an edit the same way tree-sitter adjusts the included ranges of an edited tree.
+func editRange(r tree_sitter.Range, edit tree_sitter.InputEdit) tree_sitter.Range {
+	if r.EndByte >= edit.OldEndByte {
+		r.EndByte = edit.NewEndByte + (r.EndByte - edit.OldEndByte)
+		r.EndPoint = pointAdd(edit.NewEndPosition, pointSub(r.EndPoint, edit.OldEndPosition))
+	} else if r.EndByte > edit.StartByte {
+		r.EndByte = edit.StartByte
+		r.EndPoint = edit.StartPosition
+	}
+
+	if r.StartByte >= edit.OldEndByte {
+		r.StartByte = edit.NewEndByte + (r.StartByte - edit.OldEndByte)
+		r.StartPoint = pointAdd(edit.NewEndPosition, pointSub(r.StartPoint, edit.OldEndPosition))
+	} else if r.StartByte > edit.StartByte {
+		r.StartByte = edit.StartByte
+		r.StartPoint = edit.StartPosition
+	}
+
+	return r
+}
+
+func pointAdd(a tree_sitter.Point, b tree_sitter.Point) tree_sitter.Point {
+	if b.Row > 0 {
+		return tree_sitter.Point{Row: a.Row + b.Row, Column: b.Column}
+	}
+	return tree_sitter.Point{Row: a.Row, Column: a.Column + b.Column}
+}
+
+func pointSub(a tree_sitter.Point, b tree_sitter.Point) tree_sitter.Point {
+	if a.Row > b.Row {
+		return tree_sitter.Point{Row: a.Row - b.Row, Column: a.Column}
+	}
+	return tree_sitter.Point{Row: 0, Column: a.Column - b.Column}
+}
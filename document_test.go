@@ -0,0 +1,258 @@
+package highlight
+
+import (
+	"context"
+	"iter"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tree-sitter/go-tree-sitter"
+)
+
+// replaceText replaces the first occurrence of old in the source with text and returns the matching edit.
+func replaceText(t *testing.T, source []byte, old string, text string) (tree_sitter.InputEdit, []byte) {
+	t.Helper()
+
+	i := strings.Index(string(source), old)
+	require.NotEqual(t, -1, i)
+
+	start := uint(i)
+	newSource := slices.Concat(source[:start], []byte(text), source[start+uint(len(old)):])
+	return tree_sitter.InputEdit{
+		StartByte:      start,
+		OldEndByte:     start + uint(len(old)),
+		NewEndByte:     start + uint(len(text)),
+		StartPosition:  pointAt(source, start),
+		OldEndPosition: pointAt(source, start+uint(len(old))),
+		NewEndPosition: pointAt(newSource, start+uint(len(text))),
+	}, newSource
+}
+
+func collectEvents(t *testing.T, events iter.Seq2[Event, error]) []Event {
+	t.Helper()
+
+	var result []Event
+	for event, err := range events {
+		require.NoError(t, err)
+		result = append(result, event)
+	}
+	return result
+}
+
+func byteRanges(ranges []tree_sitter.Range) [][2]uint {
+	var result [][2]uint
+	for _, r := range ranges {
+		result = append(result, [2]uint{r.StartByte, r.EndByte})
+	}
+	return result
+}
+
+func TestDocument_Update(t *testing.T) {
+	source := []byte("<p>hello</p>\n<script>\nlet a = 1;\n</script>\n<p>world</p>\n")
+
+	cfg := loadTestConfiguration(t, "html")
+	injectionCallback := testInjectionCallback(t)
+
+	doc := NewDocument(New(), *cfg, injectionCallback)
+	defer doc.Close()
+
+	ctx := context.Background()
+
+	changed, err := doc.Update(ctx, source)
+	require.NoError(t, err)
+	assert.Equal(t, [][2]uint{{0, uint(len(source))}}, byteRanges(changed))
+	assert.Equal(t, collectEvents(t, New().Highlight(ctx, *cfg, source, injectionCallback)), collectEvents(t, doc.Highlight(ctx)))
+
+	tests := []struct {
+		name     string
+		old      string
+		text     string
+		expected func(source []byte) [][2]uint
+	}{
+		{
+			name: "edit in root layer",
+			old:  "hello",
+			text: "hi",
+			expected: func(source []byte) [][2]uint {
+				return [][2]uint{byteRange(string(source), "hi", 0)}
+			},
+		},
+		{
+			name: "edit in injected layer",
+			old:  "let a = 1;",
+			text: "const a = 1;",
+			expected: func(source []byte) [][2]uint {
+				return [][2]uint{byteRange(string(source), "const a = 1;", 0)}
+			},
+		},
+		{
+			name: "new injected layer",
+			old:  "<p>world</p>",
+			text: "<style>p { color: red; }</style>",
+			expected: func(source []byte) [][2]uint {
+				return [][2]uint{byteRange(string(source), "<style>p { color: red; }</style>", 0)}
+			},
+		},
+		{
+			name: "removed injected layer",
+			old:  "<script>\nconst a = 1;\n</script>",
+			text: "<p></p>",
+			expected: func(source []byte) [][2]uint {
+				return [][2]uint{byteRange(string(source), "<p></p>", 0)}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var edit tree_sitter.InputEdit
+			edit, source = replaceText(t, source, tt.old, tt.text)
+			doc.Edit(edit)
+
+			for _, err = range doc.Highlight(ctx) {
+				assert.ErrorIs(t, err, ErrPendingEdits)
+			}
+
+			changed, err = doc.Update(ctx, source)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expected(source), byteRanges(changed))
+			for _, r := range changed {
+				assert.Equal(t, pointAt(source, r.StartByte), r.StartPoint)
+				assert.Equal(t, pointAt(source, r.EndByte), r.EndPoint)
+			}
+
+			assert.Equal(t, collectEvents(t, New().Highlight(ctx, *cfg, source, injectionCallback)), collectEvents(t, doc.Highlight(ctx)))
+		})
+	}
+}
+
+func TestDocument_UpdateMultipleEdits(t *testing.T) {
+	source := []byte("package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n")
+
+	cfg := loadTestConfiguration(t, "go")
+
+	doc := NewDocument(New(), *cfg, nil)
+	defer doc.Close()
+
+	ctx := context.Background()
+	_, err := doc.Update(ctx, source)
+	require.NoError(t, err)
+
+	edit, source := replaceText(t, source, "main()", "run()")
+	doc.Edit(edit)
+	edit, source = replaceText(t, source, "\"hello\"", "\"hello, world\"")
+	doc.Edit(edit)
+
+	changed, err := doc.Update(ctx, source)
+	require.NoError(t, err)
+
+	for _, text := range []string{"run", "\"hello, world\""} {
+		r := byteRange(string(source), text, 0)
+		assert.True(t, slices.ContainsFunc(changed, func(c tree_sitter.Range) bool {
+			return c.StartByte <= r[0] && r[1] <= c.EndByte
+		}), "%q should be in changed ranges %v", text, byteRanges(changed))
+	}
+	assert.NotContains(t, byteRanges(changed), [2]uint{0, uint(len(source))})
+
+	assert.Equal(t, collectEvents(t, New().Highlight(ctx, *cfg, source, nil)), collectEvents(t, doc.Highlight(ctx)))
+}
+
+func TestEditRange(t *testing.T) {
+	edit := tree_sitter.InputEdit{
+		StartByte:      5,
+		OldEndByte:     10,
+		NewEndByte:     7,
+		StartPosition:  tree_sitter.Point{Row: 0, Column: 5},
+		OldEndPosition: tree_sitter.Point{Row: 1, Column: 2},
+		NewEndPosition: tree_sitter.Point{Row: 0, Column: 7},
+	}
+
+	tests := []struct {
+		name     string
+		r        tree_sitter.Range
+		expected tree_sitter.Range
+	}{
+		{
+			name:     "before edit",
+			r:        tree_sitter.Range{StartByte: 0, EndByte: 5, EndPoint: tree_sitter.Point{Column: 5}},
+			expected: tree_sitter.Range{StartByte: 0, EndByte: 5, EndPoint: tree_sitter.Point{Column: 5}},
+		},
+		{
+			name:     "after edit",
+			r:        tree_sitter.Range{StartByte: 12, EndByte: 14, StartPoint: tree_sitter.Point{Row: 1, Column: 4}, EndPoint: tree_sitter.Point{Row: 1, Column: 6}},
+			expected: tree_sitter.Range{StartByte: 9, EndByte: 11, StartPoint: tree_sitter.Point{Row: 0, Column: 9}, EndPoint: tree_sitter.Point{Row: 0, Column: 11}},
+		},
+		{
+			name:     "inside edit",
+			r:        tree_sitter.Range{StartByte: 6, EndByte: 8, StartPoint: tree_sitter.Point{Row: 0, Column: 6}, EndPoint: tree_sitter.Point{Row: 1, Column: 0}},
+			expected: tree_sitter.Range{StartByte: 5, EndByte: 5, StartPoint: tree_sitter.Point{Row: 0, Column: 5}, EndPoint: tree_sitter.Point{Row: 0, Column: 5}},
+		},
+		{
+			name:     "around edit",
+			r:        tree_sitter.Range{StartByte: 2, EndByte: 12, StartPoint: tree_sitter.Point{Row: 0, Column: 2}, EndPoint: tree_sitter.Point{Row: 1, Column: 4}},
+			expected: tree_sitter.Range{StartByte: 2, EndByte: 9, StartPoint: tree_sitter.Point{Row: 0, Column: 2}, EndPoint: tree_sitter.Point{Row: 0, Column: 9}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, editRange(tt.r, edit))
+		})
+	}
+}
+
+func TestDocument_HighlightRange(t *testing.T) {
+	source := []byte("<p>hello</p>\n<script>\nlet a = `x ${b} y`;\n</script>\n<p>world</p>\n")
+
+	cfg := loadTestConfiguration(t, "html")
+	injectionCallback := testInjectionCallback(t)
+
+	doc := NewDocument(New(), *cfg, injectionCallback)
+	defer doc.Close()
+
+	ctx := context.Background()
+	_, err := doc.Update(ctx, source)
+	require.NoError(t, err)
+
+	start, end := byteRange(string(source), "llo", 0)[0], byteRange(string(source), "${b}", 0)[1]
+	assert.Equal(t, collectEvents(t, New().HighlightRange(ctx, *cfg, source, injectionCallback, start, end)), collectEvents(t, doc.HighlightRange(ctx, start, end)))
+}
+
+func TestDocument_Trees(t *testing.T) {
+	source := []byte("<script>\nlet a = 1;\n</script>\n<style>p { color: red; }</style>\n")
+
+	cfg := loadTestConfiguration(t, "html")
+
+	doc := NewDocument(New(), *cfg, testInjectionCallback(t))
+	defer doc.Close()
+
+	assert.Empty(t, doc.Trees())
+
+	_, err := doc.Update(context.Background(), source)
+	require.NoError(t, err)
+
+	kinds := func() []string {
+		var kinds []string
+		for _, tree := range doc.Trees() {
+			kinds = append(kinds, tree.RootNode().Kind())
+		}
+		return kinds
+	}
+	// the root layer comes first, followed by the injected layers
+	assert.Equal(t, []string{"document", "program", "stylesheet"}, kinds())
+
+	// the trees follow the layers of the last update
+	edit, source := replaceText(t, source, "<style>p { color: red; }</style>", "<p></p>")
+	doc.Edit(edit)
+	_, err = doc.Update(context.Background(), source)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"document", "program"}, kinds())
+	assert.False(t, doc.Trees()[1].RootNode().HasError())
+
+	doc.Close()
+	assert.Empty(t, doc.Trees())
+}
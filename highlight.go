@@ -1,7 +1,9 @@
 package highlight
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"iter"
 
 	"github.com/tree-sitter/go-tree-sitter"
@@ -12,6 +14,20 @@ type Highlight uint
 
 const DefaultHighlight = Highlight(^uint(0))
 
+// documentRange is the range covering a whole document.
+var documentRange = tree_sitter.Range{
+	StartByte: 0,
+	EndByte:   ^uint(0),
+	StartPoint: tree_sitter.Point{
+		Row:    0,
+		Column: 0,
+	},
+	EndPoint: tree_sitter.Point{
+		Row:    ^uint(0),
+		Column: ^uint(0),
+	},
+}
+
 // Event is an interface that represents a highlight event.
 // Possible implementations are:
 // - [EventLayerStart]
@@ -27,6 +43,12 @@ type Event interface {
 type EventSource struct {
 	StartByte uint
 	EndByte   uint
+	// StartPoint and EndPoint are the row and byte column of StartByte and EndByte, like the points of tree-sitter nodes.
+	StartPoint tree_sitter.Point
+	EndPoint   tree_sitter.Point
+	// StartUTF16Column and EndUTF16Column are the columns of StartByte and EndByte in UTF-16 code units, as used by LSP clients.
+	StartUTF16Column uint
+	EndUTF16Column   uint
 }
 
 func (EventSource) highlightEvent() {}
@@ -61,7 +83,7 @@ func (EventCaptureEnd) highlightEvent() {}
 type InjectionCallback func(languageName string) *Configuration
 
 // New returns a new highlighter. The highlighter is not thread-safe and should not be shared between goroutines,
-// but it can be reused to highlight multiple source code snippets.
+// but it can be reused to highlight multiple source code snippets. Use a [Pool] to highlight from multiple goroutines.
 func New() *Highlighter {
 	return &Highlighter{
 		Parser: tree_sitter.NewParser(),
@@ -72,14 +94,45 @@ func New() *Highlighter {
 type Highlighter struct {
 	Parser  *tree_sitter.Parser
 	cursors []*tree_sitter.QueryCursor
+	live    liveCounts
+}
+
+// liveCounts counts the tree-sitter objects of a highlighter which are not released yet,
+// so tests can check that highlighting releases everything it allocates.
+type liveCounts struct {
+	// trees are the syntax trees owned by the layers of iterators
+	trees int
+	// cursors are the query cursors which are created and not closed
+	cursors int
+	// borrowedCursors are the query cursors which are taken from the highlighter and not returned
+	borrowedCursors int
+}
+
+// Close releases the parser and the query cursors of the highlighter. The highlighter must not be used afterwards.
+// Closing a highlighter more than once has no effect.
+func (h *Highlighter) Close() {
+	if h.Parser != nil {
+		h.Parser.Close()
+		h.Parser = nil
+	}
+	for _, cursor := range h.cursors {
+		cursor.Close()
+		h.live.cursors--
+	}
+	h.cursors = nil
 }
 
 func (h *Highlighter) pushCursor(cursor *tree_sitter.QueryCursor) {
+	// reset the range a previous HighlightRange might have set
+	cursor.SetByteRange(0, ^uint(0))
 	h.cursors = append(h.cursors, cursor)
+	h.live.borrowedCursors--
 }
 
 func (h *Highlighter) popCursor() *tree_sitter.QueryCursor {
+	h.live.borrowedCursors++
 	if len(h.cursors) == 0 {
+		h.live.cursors++
 		return tree_sitter.NewQueryCursor()
 	}
 
@@ -91,40 +144,55 @@ func (h *Highlighter) popCursor() *tree_sitter.QueryCursor {
 // Highlight highlights the given source code using the given configuration. The source code is expected to be UTF-8 encoded.
 // The function returns an [iter.Seq2[Event, error]] that yields the highlight events or an error.
 func (h *Highlighter) Highlight(ctx context.Context, cfg Configuration, source []byte, injectionCallback InjectionCallback) iter.Seq2[Event, error] {
-	layers, err := newIterLayers(ctx, source, "", h, injectionCallback, cfg, 0, []tree_sitter.Range{
-		{
-			StartByte: 0,
-			EndByte:   ^uint(0),
-			StartPoint: tree_sitter.Point{
-				Row:    0,
-				Column: 0,
-			},
-			EndPoint: tree_sitter.Point{
-				Row:    ^uint(0),
-				Column: ^uint(0),
-			},
-		},
-	})
-	if err != nil {
-		return func(yield func(Event, error) bool) {
+	return h.highlight(ctx, cfg, source, injectionCallback, h.parseLayer(source), 0, uint(len(source)))
+}
+
+// HighlightRange highlights the source code between startByte and endByte, e.g. the visible part of a document in an editor.
+// The whole source code is still parsed, but only the captures intersecting the range are emitted.
+//
+// Captures which start before startByte are still emitted as [EventCaptureStart] before the first [EventSource],
+// so the highlight state at the start of the range is correct. [EventSource] is only emitted within the range.
+// Languages with a locals query are queried from the start of the source code, so references within the range are
+// highlighted like their definitions before it.
+func (h *Highlighter) HighlightRange(ctx context.Context, cfg Configuration, source []byte, injectionCallback InjectionCallback, startByte uint, endByte uint) iter.Seq2[Event, error] {
+	endByte = min(endByte, uint(len(source)))
+	startByte = min(startByte, endByte)
+	return h.highlight(ctx, cfg, source, injectionCallback, h.parseLayer(source), startByte, endByte)
+}
+
+// HighlightPointRange is like [Highlighter.HighlightRange] but takes a row and byte column range instead of a byte range.
+func (h *Highlighter) HighlightPointRange(ctx context.Context, cfg Configuration, source []byte, injectionCallback InjectionCallback, start tree_sitter.Point, end tree_sitter.Point) iter.Seq2[Event, error] {
+	return h.HighlightRange(ctx, cfg, source, injectionCallback, offsetAt(source, start), offsetAt(source, end))
+}
+
+// highlight returns the highlight events of the source. Parsing is deferred until the events are iterated.
+// The trees and query cursors of all layers are released once the iteration is done or stopped early.
+func (h *Highlighter) highlight(ctx context.Context, cfg Configuration, source []byte, injectionCallback InjectionCallback, parseLayer layerParser, startByte uint, endByte uint) iter.Seq2[Event, error] {
+	return func(yield func(Event, error) bool) {
+		layers, err := newIterLayers(ctx, source, "", h, parseLayer, injectionCallback, cfg, 0, []tree_sitter.Range{documentRange}, startByte, endByte)
+		if err != nil {
 			yield(nil, err)
+			return
 		}
-	}
 
-	i := &iterator{
-		Ctx:                ctx,
-		Source:             source,
-		LanguageName:       cfg.LanguageName,
-		ByteOffset:         0,
-		Highlighter:        h,
-		InjectionCallback:  injectionCallback,
-		Layers:             layers,
-		NextEvents:         nil,
-		LastHighlightRange: nil,
-	}
-	i.sortLayers()
+		i := &iterator{
+			Ctx:                ctx,
+			Source:             source,
+			LanguageName:       cfg.LanguageName,
+			ByteOffset:         startByte,
+			Position:           positionAt(source, startByte),
+			StartByte:          startByte,
+			EndByte:            endByte,
+			Highlighter:        h,
+			ParseLayer:         parseLayer,
+			InjectionCallback:  injectionCallback,
+			Layers:             layers,
+			NextEvents:         nil,
+			LastHighlightRange: nil,
+		}
+		defer i.close()
+		i.sortLayers()
 
-	return func(yield func(Event, error) bool) {
 		for {
 			event, err := i.next()
 			if err != nil {
@@ -148,6 +216,25 @@ func (h *Highlighter) Highlight(ctx context.Context, cfg Configuration, source [
 	}
 }
 
+// parseLayer returns a [layerParser] which parses the language layers of the source from scratch.
+func (h *Highlighter) parseLayer(source []byte) layerParser {
+	return func(ctx context.Context, config Configuration, _ uint, ranges []tree_sitter.Range) (*tree_sitter.Tree, error) {
+		return h.parseTree(ctx, config, source, ranges, nil)
+	}
+}
+
+// parseTree parses the ranges of the source with the language of the configuration.
+// If the ranges are invalid no tree and no error is returned.
+func (h *Highlighter) parseTree(ctx context.Context, config Configuration, source []byte, ranges []tree_sitter.Range, oldTree *tree_sitter.Tree) (*tree_sitter.Tree, error) {
+	if err := h.Parser.SetIncludedRanges(ranges); err != nil {
+		return nil, nil
+	}
+	if err := h.Parser.SetLanguage(config.Language); err != nil {
+		return nil, fmt.Errorf("error setting language: %w", err)
+	}
+	return parse(ctx, h.Parser, source, oldTree)
+}
+
 // Compute the ranges that should be included when parsing an injection.
 // This takes into account three things:
 //   - `parent_ranges` - The ranges must all fall within the *current* layer's ranges.
@@ -158,104 +245,101 @@ func (h *Highlighter) Highlight(ctx context.Context, cfg Configuration, source [
 //     other injections, the content nodes' entire ranges should be reparsed, including the ranges
 //     of their children.
 func intersectRanges(parentRanges []tree_sitter.Range, nodes []tree_sitter.Node, includesChildren bool) []tree_sitter.Range {
-	return []tree_sitter.Range{
-		nodes[0].Range(),
+	if len(parentRanges) == 0 {
+		panic("Layers should only be constructed with non-empty ranges")
+	}
+	if len(nodes) == 0 {
+		return nil
 	}
 
-	// TODO: investigate why this is not working, ported from: https://github.com/tree-sitter/tree-sitter/blob/e445532a1fea3b1dda93cee61c534f5b9acc9c16/highlight/src/lib.rs#L638 (and probably wrong lol)
-	//if len(parentRanges) == 0 {
-	//	panic("Layers should only be constructed with non-empty ranges")
-	//}
-	//
-	//parentRange := parentRanges[0]
-	//parentRanges = parentRanges[1:]
-	//
-	//cursor := nodes[0].Walk()
-	//defer cursor.Close()
-	//
-	//var results []tree_sitter.Range
-	//for _, node := range nodes {
-	//	precedingRange := tree_sitter.Range{
-	//		StartByte: 0,
-	//		StartPoint: tree_sitter.Point{
-	//			Row:    0,
-	//			Column: 0,
-	//		},
-	//		EndByte:  node.StartByte(),
-	//		EndPoint: node.StartPosition(),
-	//	}
-	//	followingRange := tree_sitter.Range{
-	//		StartByte:  node.EndByte(),
-	//		StartPoint: node.EndPosition(),
-	//		EndByte:    ^uint(0),
-	//		EndPoint: tree_sitter.Point{
-	//			Row:    ^uint(0),
-	//			Column: ^uint(0),
-	//		},
-	//	}
-	//
-	//	var excludedRanges []tree_sitter.Range
-	//	for _, child := range node.Children(cursor) {
-	//		if !includesChildren {
-	//			excludedRanges = append(excludedRanges, child.Range())
-	//		}
-	//	}
-	//	excludedRanges = append(excludedRanges, followingRange)
-	//
-	//	for _, excludedRange := range excludedRanges {
-	//		r := tree_sitter.Range{
-	//			StartByte:  precedingRange.EndByte,
-	//			StartPoint: precedingRange.EndPoint,
-	//			EndByte:    excludedRange.StartByte,
-	//			EndPoint:   excludedRange.StartPoint,
-	//		}
-	//		precedingRange = excludedRange
-	//
-	//		if r.EndByte < parentRange.StartByte {
-	//			continue
-	//		}
-	//
-	//		for parentRange.StartByte <= r.EndByte {
-	//			if parentRange.EndByte > r.StartByte {
-	//				if r.StartByte < parentRange.StartByte {
-	//					r.StartByte = parentRange.StartByte
-	//					r.StartPoint = parentRange.StartPoint
-	//				}
-	//
-	//				if parentRange.EndByte < r.EndByte {
-	//					if r.StartByte < parentRange.EndByte {
-	//						results = append(results, tree_sitter.Range{
-	//							StartByte:  r.StartByte,
-	//							StartPoint: r.StartPoint,
-	//							EndByte:    parentRange.EndByte,
-	//							EndPoint:   parentRange.EndPoint,
-	//						})
-	//					}
-	//					r.StartByte = parentRange.EndByte
-	//					r.StartPoint = parentRange.EndPoint
-	//				} else {
-	//					if r.StartByte < r.EndByte {
-	//						results = append(results, r)
-	//					}
-	//					break
-	//				}
-	//			}
-	//
-	//			if len(parentRanges) > 0 {
-	//				parentRange = parentRanges[0]
-	//				parentRanges = parentRanges[1:]
-	//			} else {
-	//				return results
-	//			}
-	//		}
-	//	}
-	//}
-	//
-	//return results
+	parentRange := parentRanges[0]
+	parentRanges = parentRanges[1:]
+
+	cursor := nodes[0].Walk()
+	defer cursor.Close()
+
+	var results []tree_sitter.Range
+	for _, node := range nodes {
+		precedingRange := tree_sitter.Range{
+			StartByte: 0,
+			StartPoint: tree_sitter.Point{
+				Row:    0,
+				Column: 0,
+			},
+			EndByte:  node.StartByte(),
+			EndPoint: node.StartPosition(),
+		}
+		followingRange := tree_sitter.Range{
+			StartByte:  node.EndByte(),
+			StartPoint: node.EndPosition(),
+			EndByte:    ^uint(0),
+			EndPoint: tree_sitter.Point{
+				Row:    ^uint(0),
+				Column: ^uint(0),
+			},
+		}
+
+		var excludedRanges []tree_sitter.Range
+		if !includesChildren {
+			for _, child := range node.Children(cursor) {
+				excludedRanges = append(excludedRanges, child.Range())
+			}
+		}
+		excludedRanges = append(excludedRanges, followingRange)
+
+		for _, excludedRange := range excludedRanges {
+			r := tree_sitter.Range{
+				StartByte:  precedingRange.EndByte,
+				StartPoint: precedingRange.EndPoint,
+				EndByte:    excludedRange.StartByte,
+				EndPoint:   excludedRange.StartPoint,
+			}
+			precedingRange = excludedRange
+
+			if r.EndByte < parentRange.StartByte {
+				continue
+			}
+
+			for parentRange.StartByte <= r.EndByte {
+				if parentRange.EndByte > r.StartByte {
+					if r.StartByte < parentRange.StartByte {
+						r.StartByte = parentRange.StartByte
+						r.StartPoint = parentRange.StartPoint
+					}
+
+					if parentRange.EndByte < r.EndByte {
+						if r.StartByte < parentRange.EndByte {
+							results = append(results, tree_sitter.Range{
+								StartByte:  r.StartByte,
+								StartPoint: r.StartPoint,
+								EndByte:    parentRange.EndByte,
+								EndPoint:   parentRange.EndPoint,
+							})
+						}
+						r.StartByte = parentRange.EndByte
+						r.StartPoint = parentRange.EndPoint
+					} else {
+						if r.StartByte < r.EndByte {
+							results = append(results, r)
+						}
+						break
+					}
+				}
+
+				if len(parentRanges) == 0 {
+					return results
+				}
+				parentRange = parentRanges[0]
+				parentRanges = parentRanges[1:]
+			}
+		}
+	}
+
+	return results
 }
 
 func injectionForMatch(config Configuration, parentName string, query *tree_sitter.Query, match tree_sitter.QueryMatch, source []byte) (string, *tree_sitter.Node, bool) {
-	if config.InjectionContentCaptureIndex == nil || config.InjectionLanguageCaptureIndex == nil {
+	if config.InjectionContentCaptureIndex == nil {
 		return "", nil, false
 	}
 
@@ -267,7 +351,7 @@ func injectionForMatch(config Configuration, parentName string, query *tree_sitt
 
 	for _, capture := range match.Captures {
 		index := uint(capture.Index)
-		if index == *config.InjectionLanguageCaptureIndex {
+		if config.InjectionLanguageCaptureIndex != nil && index == *config.InjectionLanguageCaptureIndex {
 			languageName = capture.Node.Utf8Text(source)
 		} else if index == *config.InjectionContentCaptureIndex {
 			contentNode = &capture.Node
@@ -295,3 +379,22 @@ func injectionForMatch(config Configuration, parentName string, query *tree_sitt
 
 	return languageName, contentNode, includeChildren
 }
+
+// offsetAt returns the byte offset of the row and byte column in the source.
+// Points after the end of a row or the source are clamped to the end of the row or the source.
+func offsetAt(source []byte, point tree_sitter.Point) uint {
+	var offset uint
+	for range point.Row {
+		i := bytes.IndexByte(source[offset:], '\n')
+		if i == -1 {
+			return uint(len(source))
+		}
+		offset += uint(i) + 1
+	}
+
+	lineEnd := uint(len(source))
+	if i := bytes.IndexByte(source[offset:], '\n'); i != -1 {
+		lineEnd = offset + uint(i)
+	}
+	return min(offset+point.Column, lineEnd)
+}
@@ -2,14 +2,24 @@ package highlight
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
+	"iter"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/tree-sitter/go-tree-sitter"
+	"github.com/tree-sitter/tree-sitter-css/bindings/go"
+	"github.com/tree-sitter/tree-sitter-embedded-template/bindings/go"
 	"github.com/tree-sitter/tree-sitter-go/bindings/go"
+	"github.com/tree-sitter/tree-sitter-html/bindings/go"
+	"github.com/tree-sitter/tree-sitter-javascript/bindings/go"
 )
 
 // Minimal theme for testing
@@ -21,6 +31,90 @@ var theme = map[string]int{
 	"comment":  245,
 }
 
+// testLanguages are the languages which have queries in testdata/queries
+var testLanguages = map[string]*tree_sitter.Language{
+	"css":        tree_sitter.NewLanguage(tree_sitter_css.Language()),
+	"ejs":        tree_sitter.NewLanguage(tree_sitter_embedded_template.Language()),
+	"go":         tree_sitter.NewLanguage(tree_sitter_go.Language()),
+	"html":       tree_sitter.NewLanguage(tree_sitter_html.Language()),
+	"javascript": tree_sitter.NewLanguage(tree_sitter_javascript.Language()),
+}
+
+// loadTestConfiguration creates a configuration from the queries in testdata/queries/<languageName>
+// and configures it with the StandardCaptureNames.
+func loadTestConfiguration(t *testing.T, languageName string) *Configuration {
+	t.Helper()
+
+	readQuery := func(name string) []byte {
+		data, err := os.ReadFile(filepath.Join("testdata", "queries", languageName, name+".scm"))
+		if !errors.Is(err, fs.ErrNotExist) {
+			require.NoError(t, err)
+		}
+		return data
+	}
+
+	cfg, err := NewConfiguration(testLanguages[languageName], languageName, readQuery("highlights"), readQuery("injections"), readQuery("locals"))
+	require.NoError(t, err)
+
+	cfg.Configure(StandardCaptureNames)
+	return cfg
+}
+
+// testInjectionCallback returns an InjectionCallback which loads the test configuration for the injected language.
+func testInjectionCallback(t *testing.T) InjectionCallback {
+	configs := make(map[string]*Configuration)
+	return func(languageName string) *Configuration {
+		if _, ok := testLanguages[languageName]; !ok {
+			return nil
+		}
+		if _, ok := configs[languageName]; !ok {
+			configs[languageName] = loadTestConfiguration(t, languageName)
+		}
+		return configs[languageName]
+	}
+}
+
+// highlightedText is a piece of source code with the innermost highlight name and the active language.
+type highlightedText struct {
+	Language string
+	Name     string
+	Text     string
+}
+
+// collectHighlights collects the highlighted source code ranges of the events using the capture names.
+func collectHighlights(t *testing.T, events iter.Seq2[Event, error], source []byte, captureNames []string) []highlightedText {
+	t.Helper()
+
+	var (
+		language   string
+		highlights []string
+		result     []highlightedText
+	)
+	for event, err := range events {
+		require.NoError(t, err)
+
+		switch e := event.(type) {
+		case EventLayerStart:
+			language = e.LanguageName
+		case EventCaptureStart:
+			highlights = append(highlights, captureNames[e.Highlight])
+		case EventCaptureEnd:
+			highlights = highlights[:len(highlights)-1]
+		case EventSource:
+			if len(highlights) == 0 {
+				continue
+			}
+			result = append(result, highlightedText{
+				Language: language,
+				Name:     highlights[len(highlights)-1],
+				Text:     string(source[e.StartByte:e.EndByte]),
+			})
+		}
+	}
+
+	return result
+}
+
 // resetStyle resets the terminal color
 const resetStyle = "\x1b[0m"
 
@@ -44,7 +138,7 @@ func TestHighlighter_Highlight(t *testing.T) {
 
 	language := tree_sitter.NewLanguage(tree_sitter_go.Language())
 
-	highlightsQuery, err := os.ReadFile("testdata/highlights.scm")
+	highlightsQuery, err := os.ReadFile("testdata/queries/go/highlights.scm")
 	require.NoError(t, err)
 
 	cfg, err := NewConfiguration(language, "go", highlightsQuery, nil, nil)
@@ -90,3 +184,500 @@ func TestHighlighter_Highlight(t *testing.T) {
 		}
 	}
 }
+
+// findNodes returns all nodes of the given kind in the tree in document order.
+func findNodes(node tree_sitter.Node, kind string) []tree_sitter.Node {
+	var nodes []tree_sitter.Node
+	if node.Kind() == kind {
+		nodes = append(nodes, node)
+	}
+
+	cursor := node.Walk()
+	defer cursor.Close()
+	for _, child := range node.Children(cursor) {
+		nodes = append(nodes, findNodes(child, kind)...)
+	}
+	return nodes
+}
+
+// byteRange returns the range of the first occurrence of substr in source after the given offset.
+func byteRange(source string, substr string, after uint) [2]uint {
+	start := uint(strings.Index(source[after:], substr)) + after
+	return [2]uint{start, start + uint(len(substr))}
+}
+
+func TestIntersectRanges(t *testing.T) {
+	source := "<div>\n<script>let a = html`<b>${x}</b>`;</script>\n<style>a { color: red; }</style>\n</div>\n"
+
+	htmlLanguage := tree_sitter.NewLanguage(tree_sitter_html.Language())
+	jsLanguage := tree_sitter.NewLanguage(tree_sitter_javascript.Language())
+
+	parser := tree_sitter.NewParser()
+	defer parser.Close()
+
+	require.NoError(t, parser.SetLanguage(htmlLanguage))
+	htmlTree := parser.Parse([]byte(source), nil)
+	defer htmlTree.Close()
+
+	rawTexts := findNodes(htmlTree.RootNode(), "raw_text")
+	require.Len(t, rawTexts, 2)
+	script, style := rawTexts[0], rawTexts[1]
+
+	require.NoError(t, parser.SetIncludedRanges([]tree_sitter.Range{script.Range()}))
+	require.NoError(t, parser.SetLanguage(jsLanguage))
+	jsTree := parser.Parse([]byte(source), nil)
+	defer jsTree.Close()
+
+	documentRange := tree_sitter.Range{
+		StartByte: 0,
+		EndByte:   ^uint(0),
+		EndPoint: tree_sitter.Point{
+			Row:    ^uint(0),
+			Column: ^uint(0),
+		},
+	}
+
+	rangeOf := func(start uint, end uint) tree_sitter.Range {
+		return tree_sitter.Range{
+			StartByte:  start,
+			EndByte:    end,
+			StartPoint: tree_sitter.Point{Row: uint(strings.Count(source[:start], "\n")), Column: start - uint(strings.LastIndex(source[:start], "\n")+1)},
+			EndPoint:   tree_sitter.Point{Row: uint(strings.Count(source[:end], "\n")), Column: end - uint(strings.LastIndex(source[:end], "\n")+1)},
+		}
+	}
+
+	tests := []struct {
+		name             string
+		parentRanges     []tree_sitter.Range
+		nodes            []tree_sitter.Node
+		includesChildren bool
+		expected         [][2]uint
+	}{
+		{
+			name:         "single node in document",
+			parentRanges: []tree_sitter.Range{documentRange},
+			nodes:        []tree_sitter.Node{script},
+			expected:     [][2]uint{byteRange(source, "let a = html`<b>${x}</b>`;", 0)},
+		},
+		{
+			name:         "multiple nodes in document",
+			parentRanges: []tree_sitter.Range{documentRange},
+			nodes:        []tree_sitter.Node{script, style},
+			expected: [][2]uint{
+				byteRange(source, "let a = html`<b>${x}</b>`;", 0),
+				byteRange(source, "a { color: red; }", 0),
+			},
+		},
+		{
+			name:         "node clipped to parent range",
+			parentRanges: []tree_sitter.Range{rangeOf(byteRange(source, "a = html", 0)[0], uint(len(source)))},
+			nodes:        []tree_sitter.Node{script},
+			expected:     [][2]uint{byteRange(source, "a = html`<b>${x}</b>`;", 0)},
+		},
+		{
+			name: "node split by parent ranges",
+			parentRanges: []tree_sitter.Range{
+				rangeOf(byteRange(source, "let", 0)[0], byteRange(source, "let", 0)[1]),
+				rangeOf(byteRange(source, "html", 0)[0], byteRange(source, "a { color", 0)[1]),
+			},
+			nodes: []tree_sitter.Node{script, style},
+			expected: [][2]uint{
+				byteRange(source, "let", 0),
+				byteRange(source, "html`<b>${x}</b>`;", 0),
+				byteRange(source, "a { color", byteRange(source, "<style>", 0)[1]),
+			},
+		},
+		{
+			name:         "node outside of parent ranges",
+			parentRanges: []tree_sitter.Range{script.Range()},
+			nodes:        []tree_sitter.Node{style},
+			expected:     nil,
+		},
+		{
+			name:         "children excluded",
+			parentRanges: []tree_sitter.Range{documentRange},
+			nodes:        []tree_sitter.Node{findNodes(htmlTree.RootNode(), "element")[0]},
+			expected: [][2]uint{
+				byteRange(source, "\n", 0),
+				byteRange(source, "\n", byteRange(source, "</script>", 0)[1]),
+				byteRange(source, "\n", byteRange(source, "</style>", 0)[1]),
+			},
+		},
+		{
+			name:             "children included",
+			parentRanges:     []tree_sitter.Range{documentRange},
+			nodes:            findNodes(htmlTree.RootNode(), "element"),
+			includesChildren: true,
+			expected:         [][2]uint{{0, uint(len(source) - 1)}},
+		},
+		{
+			name:             "nested injection in injected layer",
+			parentRanges:     []tree_sitter.Range{script.Range()},
+			nodes:            findNodes(jsTree.RootNode(), "string_fragment"),
+			includesChildren: true,
+			expected: [][2]uint{
+				byteRange(source, "<b>", byteRange(source, "html`", 0)[1]),
+				byteRange(source, "</b>", 0),
+			},
+		},
+		{
+			name:         "nested injection without children",
+			parentRanges: []tree_sitter.Range{script.Range()},
+			nodes:        findNodes(jsTree.RootNode(), "template_string"),
+			expected:     nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranges := intersectRanges(tt.parentRanges, tt.nodes, tt.includesChildren)
+
+			var actual [][2]uint
+			for _, r := range ranges {
+				actual = append(actual, [2]uint{r.StartByte, r.EndByte})
+				assert.Equal(t, rangeOf(r.StartByte, r.EndByte), r)
+			}
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestHighlighter_HighlightCombinedInjections(t *testing.T) {
+	source := []byte("<ul>\n<% items.forEach(function(item) { %>\n<li><%= item %></li>\n<% }) %>\n</ul>\n")
+
+	cfg := loadTestConfiguration(t, "ejs")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	events := New().Highlight(ctx, *cfg, source, testInjectionCallback(t))
+
+	highlights := collectHighlights(t, events, source, StandardCaptureNames)
+	assert.Contains(t, highlights, highlightedText{Language: "ejs", Name: "keyword", Text: "<%"})
+	assert.Contains(t, highlights, highlightedText{Language: "html", Name: "tag", Text: "ul"})
+	assert.Contains(t, highlights, highlightedText{Language: "html", Name: "tag", Text: "li"})
+	assert.Contains(t, highlights, highlightedText{Language: "javascript", Name: "keyword", Text: "function"})
+}
+
+func TestHighlighter_HighlightLocals(t *testing.T) {
+	source := []byte(`package main
+
+const Limit = 10
+
+func add(a int, b int) int {
+	c := a + b
+	return c
+}
+
+func sub(x int) int {
+	return x
+}
+
+func other() int {
+	for i := range Limit {
+		return i + x
+	}
+	return Limit
+}
+`)
+
+	cfg := loadTestConfiguration(t, "go")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	events := New().Highlight(ctx, *cfg, source, testInjectionCallback(t))
+
+	var actual []highlightedText
+	for _, highlight := range collectHighlights(t, events, source, StandardCaptureNames) {
+		if strings.HasPrefix(highlight.Name, "variable") || highlight.Name == "constant" {
+			actual = append(actual, highlight)
+		}
+	}
+
+	assert.Equal(t, []highlightedText{
+		{Language: "go", Name: "constant", Text: "Limit"},
+		{Language: "go", Name: "variable.parameter", Text: "a"},
+		{Language: "go", Name: "variable.parameter", Text: "b"},
+		{Language: "go", Name: "variable", Text: "c"},
+		{Language: "go", Name: "variable.parameter", Text: "a"},
+		{Language: "go", Name: "variable.parameter", Text: "b"},
+		{Language: "go", Name: "variable", Text: "c"},
+		{Language: "go", Name: "variable.parameter", Text: "x"},
+		{Language: "go", Name: "variable.parameter", Text: "x"},
+		{Language: "go", Name: "variable", Text: "i"},
+		{Language: "go", Name: "constant", Text: "Limit"},
+		{Language: "go", Name: "variable", Text: "i"},
+		// x is not defined in this scope and should not inherit the parameter highlight
+		{Language: "go", Name: "variable", Text: "x"},
+		{Language: "go", Name: "constant", Text: "Limit"},
+	}, actual)
+}
+
+func TestHighlighter_HighlightNonLocalPatterns(t *testing.T) {
+	source := []byte("package main\n\nfunc f(N int) int {\n\treturn N + M\n}\n")
+
+	highlightsQuery := []byte(`
+(identifier) @variable
+
+((identifier) @constant
+  (#is-not? local)
+  (#match? @constant "^[A-Z]"))
+
+(parameter_declaration
+  (identifier) @variable.parameter)
+`)
+
+	localsQuery, err := os.ReadFile("testdata/queries/go/locals.scm")
+	require.NoError(t, err)
+
+	cfg, err := NewConfiguration(testLanguages["go"], "go", highlightsQuery, nil, localsQuery)
+	require.NoError(t, err)
+	cfg.Configure(StandardCaptureNames)
+
+	assert.Equal(t, []bool{false, false, false, false, false, false, false, false, false, false, true, false}, cfg.NonLocalVariablePatterns[cfg.LocalsPatternIndex:])
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	events := New().Highlight(ctx, *cfg, source, testInjectionCallback(t))
+
+	assert.Equal(t, []highlightedText{
+		{Language: "go", Name: "variable", Text: "f"},
+		{Language: "go", Name: "variable.parameter", Text: "N"},
+		{Language: "go", Name: "variable.parameter", Text: "N"},
+		{Language: "go", Name: "constant", Text: "M"},
+	}, collectHighlights(t, events, source, StandardCaptureNames))
+}
+
+// highlightNames returns the innermost highlight name for every byte of the source covered by an EventSource.
+func highlightNames(t *testing.T, events iter.Seq2[Event, error], source []byte, captureNames []string) map[uint]string {
+	t.Helper()
+
+	var highlights []string
+	names := make(map[uint]string)
+	for event, err := range events {
+		require.NoError(t, err)
+
+		switch e := event.(type) {
+		case EventCaptureStart:
+			highlights = append(highlights, captureNames[e.Highlight])
+		case EventCaptureEnd:
+			highlights = highlights[:len(highlights)-1]
+		case EventSource:
+			for i := e.StartByte; i < e.EndByte; i++ {
+				names[i] = ""
+				if len(highlights) > 0 {
+					names[i] = highlights[len(highlights)-1]
+				}
+			}
+		}
+	}
+	require.Empty(t, highlights, "all captures should be closed")
+
+	return names
+}
+
+func TestHighlighter_HighlightRange(t *testing.T) {
+	goSource := "package main\n\n/*\na long comment\n*/\nfunc main() {\n\tprintln(\"hello\\nworld\")\n}\n"
+	localsSource := "func f(param int) int {\n\n\n\treturn param\n}\n"
+	htmlSource := "<p>hello</p>\n<script>\nfunction f(a) {\n  return `template ${a} string`;\n}\n</script>\n<p>world</p>\n"
+
+	tests := []struct {
+		name      string
+		language  string
+		source    string
+		startByte uint
+		endByte   uint
+	}{
+		{
+			name:      "whole document",
+			language:  "go",
+			source:    goSource,
+			startByte: 0,
+			endByte:   uint(len(goSource)),
+		},
+		{
+			name:      "start inside comment",
+			language:  "go",
+			source:    goSource,
+			startByte: byteRange(goSource, "long", 0)[0],
+			endByte:   byteRange(goSource, "println", 0)[1],
+		},
+		{
+			name:      "start and end inside string",
+			language:  "go",
+			source:    goSource,
+			startByte: byteRange(goSource, "ello", 0)[0],
+			endByte:   byteRange(goSource, "wor", 0)[1],
+		},
+		{
+			name:      "empty range",
+			language:  "go",
+			source:    goSource,
+			startByte: 20,
+			endByte:   20,
+		},
+		{
+			name:      "end after source",
+			language:  "go",
+			source:    goSource,
+			startByte: byteRange(goSource, "func", 0)[0],
+			endByte:   ^uint(0),
+		},
+		{
+			name:      "local defined before range",
+			language:  "go",
+			source:    localsSource,
+			startByte: byteRange(localsSource, "return", 0)[0],
+			endByte:   uint(len(localsSource)),
+		},
+		{
+			name:      "only local reference",
+			language:  "go",
+			source:    localsSource,
+			startByte: byteRange(localsSource, "param", byteRange(localsSource, "return", 0)[0])[0],
+			endByte:   byteRange(localsSource, "param", byteRange(localsSource, "return", 0)[0])[1],
+		},
+		{
+			name:      "start inside injection",
+			language:  "html",
+			source:    htmlSource,
+			startByte: byteRange(htmlSource, "plate", 0)[0],
+			endByte:   byteRange(htmlSource, "world", 0)[1],
+		},
+		{
+			name:      "end inside injection",
+			language:  "html",
+			source:    htmlSource,
+			startByte: byteRange(htmlSource, "llo", 0)[0],
+			endByte:   byteRange(htmlSource, "{a}", 0)[1],
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := []byte(tt.source)
+			cfg := loadTestConfiguration(t, tt.language)
+			ctx := context.Background()
+
+			expected := make(map[uint]string)
+			for i, name := range highlightNames(t, New().Highlight(ctx, *cfg, source, testInjectionCallback(t)), source, StandardCaptureNames) {
+				if i >= tt.startByte && i < tt.endByte {
+					expected[i] = name
+				}
+			}
+
+			events := New().HighlightRange(ctx, *cfg, source, testInjectionCallback(t), tt.startByte, tt.endByte)
+			assert.Equal(t, expected, highlightNames(t, events, source, StandardCaptureNames))
+
+			var text []byte
+			for event, err := range New().HighlightRange(ctx, *cfg, source, testInjectionCallback(t), tt.startByte, tt.endByte) {
+				require.NoError(t, err)
+				if e, ok := event.(EventSource); ok {
+					text = append(text, source[e.StartByte:e.EndByte]...)
+				}
+			}
+			assert.Equal(t, string(source[min(tt.startByte, uint(len(source))):min(tt.endByte, uint(len(source)))]), string(text))
+		})
+	}
+}
+
+func TestHighlighter_HighlightPointRange(t *testing.T) {
+	source := []byte("package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n")
+	cfg := loadTestConfiguration(t, "go")
+	ctx := context.Background()
+
+	expected := collectEvents(t, New().HighlightRange(ctx, *cfg, source, nil, byteRange(string(source), "main()", 0)[0], byteRange(string(source), "println", 0)[1]))
+	actual := collectEvents(t, New().HighlightPointRange(ctx, *cfg, source, nil, tree_sitter.Point{Row: 2, Column: 5}, tree_sitter.Point{Row: 3, Column: 8}))
+	assert.Equal(t, expected, actual)
+}
+
+func TestOffsetAt(t *testing.T) {
+	source := []byte("ab\ncde\n\nf")
+
+	tests := []struct {
+		point    tree_sitter.Point
+		expected uint
+	}{
+		{tree_sitter.Point{Row: 0, Column: 0}, 0},
+		{tree_sitter.Point{Row: 0, Column: 2}, 2},
+		{tree_sitter.Point{Row: 0, Column: 10}, 2},
+		{tree_sitter.Point{Row: 1, Column: 1}, 4},
+		{tree_sitter.Point{Row: 2, Column: 0}, 7},
+		{tree_sitter.Point{Row: 3, Column: 1}, 9},
+		{tree_sitter.Point{Row: 10, Column: 0}, 9},
+	}
+
+	for _, tt := range tests {
+		offset := offsetAt(source, tt.point)
+		assert.Equal(t, tt.expected, offset, "offsetAt(%v)", tt.point)
+		if tt.point.Row < 4 && tt.point.Column < 3 {
+			assert.Equal(t, tt.point, pointAt(source, offset), "pointAt(%d)", offset)
+		}
+	}
+}
+
+func TestHighlighter_Close(t *testing.T) {
+	source := []byte("package main\n")
+	cfg := loadTestConfiguration(t, "go")
+
+	h := New()
+	collectEvents(t, h.Highlight(context.Background(), *cfg, source, nil))
+	require.NotEmpty(t, h.cursors)
+
+	h.Close()
+	assert.Nil(t, h.Parser)
+	assert.Nil(t, h.cursors)
+
+	// closing again must not release the parser twice
+	h.Close()
+}
+
+func TestHighlighter_HighlightNoLeaks(t *testing.T) {
+	sources := []struct {
+		language string
+		source   []byte
+	}{
+		{language: "go", source: []byte("package main\n\nfunc main() {\n\ta := 1\n\tprintln(a, \"hello\")\n}\n")},
+		{language: "html", source: []byte("<p>hello</p>\n<script>\nlet a = `x ${b} y`;\n</script>\n<style>p { color: red; }</style>\n")},
+		{language: "ejs", source: []byte("<ul>\n<% items.forEach(function(item) { %>\n<li><%= item %></li>\n<% }) %>\n</ul>\n")},
+	}
+
+	injectionCallback := testInjectionCallback(t)
+	h := New()
+
+	ctx := context.Background()
+	for _, source := range sources {
+		cfg := injectionCallback(source.language)
+
+		for name, events := range map[string]iter.Seq2[Event, error]{
+			"highlight": h.Highlight(ctx, *cfg, source.source, injectionCallback),
+			"range":     h.HighlightRange(ctx, *cfg, source.source, injectionCallback, 10, 40),
+		} {
+			for _, err := range events {
+				require.NoError(t, err)
+			}
+			assert.Zero(t, h.live.trees, "%s %s: trees", source.language, name)
+			assert.Zero(t, h.live.borrowedCursors, "%s %s: borrowed cursors", source.language, name)
+
+			// stopping early must release the remaining layers as well
+			for range events {
+				break
+			}
+			assert.Zero(t, h.live.trees, "%s %s stopped early: trees", source.language, name)
+			assert.Zero(t, h.live.borrowedCursors, "%s %s stopped early: borrowed cursors", source.language, name)
+		}
+
+		// cancelling the highlight must release the layers which are parsed already
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		for _, err := range h.Highlight(cancelled, *cfg, source.source, injectionCallback) {
+			require.ErrorIs(t, err, context.Canceled)
+		}
+		assert.Zero(t, h.live.trees, "%s cancelled: trees", source.language)
+		assert.Zero(t, h.live.borrowedCursors, "%s cancelled: borrowed cursors", source.language)
+	}
+
+	// the cursors are reused and released with the highlighter
+	assert.Equal(t, len(h.cursors), h.live.cursors)
+	h.Close()
+	assert.Zero(t, h.live.cursors)
+}
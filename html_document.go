@@ -0,0 +1,103 @@
+package highlight
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"iter"
+)
+
+// DefaultDocumentTemplate is the template used by [HTMLRender.RenderDocument] and [HTMLRender.RenderThemeDocument]
+// if the DocumentTemplate of the [HTMLRender] is nil.
+var DefaultDocumentTemplate = template.Must(template.New("document").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .Title }}</title>
+<style>
+{{ .CSS }}</style>
+</head>
+<body>
+{{ .Code }}</body>
+</html>
+`))
+
+// DocumentData is the data [HTMLRender.RenderDocument] and [HTMLRender.RenderThemeDocument] execute the document template with.
+type DocumentData struct {
+	// Title is the title of the document. It is escaped by the template.
+	Title string
+	// Theme is the theme of the document. It is nil for [HTMLRender.RenderDocument].
+	Theme *Theme
+	// CSS are the rules of the theme rendered by [HTMLRender.RenderCSS] or [HTMLRender.RenderCSSForNames] and the rules
+	// for the line elements.
+	CSS template.CSS
+	// Code is the rendered code wrapped in a <pre><code> element, or the table of lines for [LineModeTable].
+	Code template.HTML
+}
+
+// RenderDocument renders a full HTML document with the code and theme embedded.
+// The theme maps capture names to CSS declarations, see [HTMLRender.RenderCSS].
+// The document is rendered using the DocumentTemplate of the [HTMLRender], or [DefaultDocumentTemplate] if it is nil,
+// with [DocumentData] so the code can be embedded in a custom layout.
+// Use [HTMLRender.RenderThemeDocument] to render a document with a [Theme].
+func (r *HTMLRender) RenderDocument(w io.Writer, events iter.Seq2[Event, error], title string, source []byte, captureNames []string, theme map[string]string) error {
+	var css bytes.Buffer
+	if err := r.RenderCSS(&css, theme); err != nil {
+		return err
+	}
+
+	return r.renderDocument(w, events, title, source, nil, &css, r.ThemesAttributeCallback(nil, captureNames))
+}
+
+// RenderThemeDocument is like [HTMLRender.RenderDocument] but embeds the css of a [Theme] rendered by
+// [HTMLRender.RenderCSSForNames] and sets the classes with [HTMLRender.ThemeAttributeCallback].
+func (r *HTMLRender) RenderThemeDocument(w io.Writer, events iter.Seq2[Event, error], title string, source []byte, captureNames []string, theme *Theme) error {
+	var css bytes.Buffer
+	if err := r.RenderCSSForNames(&css, theme, captureNames); err != nil {
+		return err
+	}
+
+	return r.renderDocument(w, events, title, source, theme, &css, r.ThemeAttributeCallback(theme, captureNames))
+}
+
+// renderDocument renders the document with the css of the theme and the code rendered with the callback.
+func (r *HTMLRender) renderDocument(w io.Writer, events iter.Seq2[Event, error], title string, source []byte, theme *Theme, css *bytes.Buffer, callback AttributeCallback) error {
+	if r.LineNumbers {
+		if _, err := fmt.Fprintf(css, ".%sline-number{user-select:none}", r.ClassNamePrefix); err != nil {
+			return err
+		}
+	}
+
+	// tables can't be placed in a <pre> element, so the line cells keep the whitespace themselves
+	start, end := "<pre><code>\n", "</code></pre>\n"
+	if r.LineMode == LineModeTable {
+		if _, err := fmt.Fprintf(css, ".%slines{font-family:monospace;border-spacing:0}.%sline{white-space:pre}", r.ClassNamePrefix, r.ClassNamePrefix); err != nil {
+			return err
+		}
+		start, end = "", "\n"
+	}
+
+	var code bytes.Buffer
+	code.WriteString(start)
+	if err := r.Render(&code, events, source, callback); err != nil {
+		return err
+	}
+	code.WriteString(end)
+
+	tmpl := r.DocumentTemplate
+	if tmpl == nil {
+		tmpl = DefaultDocumentTemplate
+	}
+
+	if err := tmpl.Execute(w, DocumentData{
+		Title: title,
+		Theme: theme,
+		CSS:   template.CSS(css.String()),
+		Code:  template.HTML(code.String()),
+	}); err != nil {
+		return fmt.Errorf("error while executing document template: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package highlight
+
+import (
+	"bytes"
+	"html/template"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTMLRender_RenderThemeDocument(t *testing.T) {
+	source := "a<b"
+	events := []Event{
+		EventLayerStart{LanguageName: "go"},
+		EventCaptureStart{Highlight: 0},
+		EventSource{StartByte: 0, EndByte: 3},
+		EventCaptureEnd{},
+	}
+	captureNames := []string{"keyword"}
+	theme := &Theme{
+		Styles: map[string]Style{
+			"keyword": {Bold: true},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		template *template.Template
+		title    string
+		expected string
+	}{
+		{
+			name:  "default template",
+			title: `</title><script>alert("x")</script>`,
+			expected: `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>&lt;/title&gt;&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;</title>
+<style>
+.hl-keyword{font-weight:bold;}</style>
+</head>
+<body>
+<pre><code>
+<span class="hl-keyword">a&lt;b</span></code></pre>
+</body>
+</html>
+`,
+		},
+		{
+			name:     "custom template",
+			template: template.Must(template.New("custom").Parse(`<head><meta name="title" content="{{ .Title }}"><style>{{ .CSS }}</style></head><main>{{ .Code }}</main>`)),
+			title:    `"main.go"`,
+			expected: `<head><meta name="title" content="&#34;main.go&#34;"><style>.hl-keyword{font-weight:bold;}</style></head>` +
+				`<main><pre><code>` + "\n" + `<span class="hl-keyword">a&lt;b</span></code></pre>` + "\n" + `</main>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewHTMLRender()
+			r.DocumentTemplate = tt.template
+
+			var buf bytes.Buffer
+			err := r.RenderThemeDocument(&buf, eventsOf(events...), tt.title, []byte(source), captureNames, theme)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, buf.String())
+		})
+	}
+}
+
+func TestHTMLRender_RenderDocument(t *testing.T) {
+	events := []Event{
+		EventLayerStart{LanguageName: "go"},
+		EventCaptureStart{Highlight: 0},
+		EventSource{StartByte: 0, EndByte: 3},
+		EventCaptureEnd{},
+	}
+
+	var buf bytes.Buffer
+	err := NewHTMLRender().RenderDocument(&buf, eventsOf(events...), "test", []byte("a<b"), []string{"keyword"}, map[string]string{
+		"keyword": "font-weight:bold;",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>test</title>
+<style>
+.hl-keyword{font-weight:bold;}</style>
+</head>
+<body>
+<pre><code>
+<span class="hl-keyword">a&lt;b</span></code></pre>
+</body>
+</html>
+`, buf.String())
+}
@@ -0,0 +1,128 @@
+package highlight
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// LineRange is an inclusive range of line numbers.
+type LineRange struct {
+	Start uint
+	End   uint
+}
+
+// Contains reports whether the line is in the range.
+func (r LineRange) Contains(line uint) bool {
+	return line >= r.Start && line <= r.End
+}
+
+// ParseLineRanges parses comma-separated line numbers and ranges of line numbers like "3,7-9" or "{3,7-9}".
+func ParseLineRanges(s string) ([]LineRange, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "{")
+	s = strings.TrimSuffix(s, "}")
+
+	var ranges []LineRange
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		startStr, endStr, isRange := strings.Cut(part, "-")
+		start, err := strconv.ParseUint(strings.TrimSpace(startStr), 10, 0)
+		if err != nil {
+			return nil, fmt.Errorf("invalid line range %q: %w", part, err)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.ParseUint(strings.TrimSpace(endStr), 10, 0); err != nil {
+				return nil, fmt.Errorf("invalid line range %q: %w", part, err)
+			}
+		}
+		if end < start {
+			return nil, fmt.Errorf("invalid line range %q: end is before start", part)
+		}
+
+		ranges = append(ranges, LineRange{Start: uint(start), End: uint(end)})
+	}
+
+	return ranges, nil
+}
+
+func isHighlightedLine(ranges []LineRange, line uint) bool {
+	for _, r := range ranges {
+		if r.Contains(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// Overlay marks the bytes from StartByte to EndByte of the source code with a CSS class.
+type Overlay struct {
+	StartByte uint
+	EndByte   uint
+	// Class is the class of the overlay span, prefixed with the ClassNamePrefix of the [HTMLRender] like the other classes.
+	Class string
+}
+
+// overlaySet finds the overlays containing a byte offset. The offsets must be passed in increasing order.
+type overlaySet struct {
+	// overlays are sorted by their start, the outermost overlay first
+	overlays []Overlay
+	// boundaries are the sorted offsets at which overlays start or end
+	boundaries []uint
+	next       int
+}
+
+func newOverlaySet(overlays []Overlay) overlaySet {
+	sorted := slices.Clone(overlays)
+	sorted = slices.DeleteFunc(sorted, func(overlay Overlay) bool {
+		return overlay.EndByte <= overlay.StartByte
+	})
+	slices.SortStableFunc(sorted, func(a, b Overlay) int {
+		if a.StartByte != b.StartByte {
+			return cmp.Compare(a.StartByte, b.StartByte)
+		}
+		return cmp.Compare(b.EndByte, a.EndByte)
+	})
+
+	boundaries := make([]uint, 0, len(sorted)*2)
+	for _, overlay := range sorted {
+		boundaries = append(boundaries, overlay.StartByte, overlay.EndByte)
+	}
+	slices.Sort(boundaries)
+
+	return overlaySet{
+		overlays:   sorted,
+		boundaries: slices.Compact(boundaries),
+	}
+}
+
+// crossBoundary reports whether an overlay starts or ends between the previous offset and the given offset.
+func (s *overlaySet) crossBoundary(offset uint) bool {
+	crossed := false
+	for s.next < len(s.boundaries) && s.boundaries[s.next] <= offset {
+		s.next++
+		crossed = true
+	}
+	return crossed
+}
+
+// active returns the overlays containing the offset.
+func (s *overlaySet) active(offset uint) []Overlay {
+	var active []Overlay
+	for _, overlay := range s.overlays {
+		if overlay.StartByte > offset {
+			break
+		}
+		if offset < overlay.EndByte {
+			active = append(active, overlay)
+		}
+	}
+	return active
+}
@@ -0,0 +1,143 @@
+package highlight
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLineRanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []LineRange
+		wantErr  bool
+	}{
+		{name: "empty", input: "", expected: nil},
+		{name: "single line", input: "3", expected: []LineRange{{Start: 3, End: 3}}},
+		{name: "braces", input: "{3,7-9}", expected: []LineRange{{Start: 3, End: 3}, {Start: 7, End: 9}}},
+		{name: "spaces", input: " 1 , 2 - 4 ", expected: []LineRange{{Start: 1, End: 1}, {Start: 2, End: 4}}},
+		{name: "invalid number", input: "a", wantErr: true},
+		{name: "reversed range", input: "9-7", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranges, err := ParseLineRanges(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, ranges)
+		})
+	}
+}
+
+func TestHTMLRender_RenderOverlays(t *testing.T) {
+	source := "func main() {\n\treturn\n}"
+	events := []Event{
+		EventLayerStart{LanguageName: "go"},
+		EventCaptureStart{Highlight: 0},
+		EventSource{StartByte: 0, EndByte: 4},
+		EventCaptureEnd{},
+		EventSource{StartByte: 4, EndByte: 5},
+		EventCaptureStart{Highlight: 1},
+		EventSource{StartByte: 5, EndByte: 9},
+		EventCaptureEnd{},
+		EventSource{StartByte: 9, EndByte: 15},
+		EventCaptureStart{Highlight: 0},
+		EventSource{StartByte: 15, EndByte: 21},
+		EventCaptureEnd{},
+		EventSource{StartByte: 21, EndByte: 23},
+	}
+	captureNames := []string{"keyword", "function"}
+
+	tests := []struct {
+		name      string
+		configure func(r *HTMLRender)
+		expected  string
+	}{
+		{
+			name: "overlay splits captures",
+			configure: func(r *HTMLRender) {
+				r.Overlays = []Overlay{{StartByte: 2, EndByte: 7, Class: "error"}}
+			},
+			expected: `<span class="hl-keyword">fu</span><span class="hl-error"><span class="hl-keyword">nc</span> <span class="hl-function">ma</span></span><span class="hl-function">in</span>() {` + "\n" +
+				"\t" + `<span class="hl-keyword">return</span>` + "\n" +
+				"}",
+		},
+		{
+			name: "overlapping overlays across lines",
+			configure: func(r *HTMLRender) {
+				r.Overlays = []Overlay{
+					{StartByte: 17, EndByte: 23, Class: "b"},
+					{StartByte: 12, EndByte: 18, Class: "a"},
+				}
+			},
+			expected: `<span class="hl-keyword">func</span> <span class="hl-function">main</span>() <span class="hl-a">{</span>` + "\n" +
+				`<span class="hl-a">` + "\t" + `<span class="hl-keyword">re</span></span><span class="hl-a"><span class="hl-b"><span class="hl-keyword">t</span></span></span><span class="hl-b"><span class="hl-keyword">urn</span></span>` + "\n" +
+				`<span class="hl-b">}</span>`,
+		},
+		{
+			name: "highlighted lines without line mode",
+			configure: func(r *HTMLRender) {
+				r.HighlightedLines = []LineRange{{Start: 2, End: 3}}
+			},
+			expected: `<span class="hl-keyword">func</span> <span class="hl-function">main</span>() {` + "\n" +
+				`<span class="hl-line-highlighted">` + "\t" + `<span class="hl-keyword">return</span></span>` + "\n" +
+				`<span class="hl-line-highlighted">}</span>`,
+		},
+		{
+			name: "highlighted lines with span lines",
+			configure: func(r *HTMLRender) {
+				r.LineMode = LineModeSpan
+				r.LineIDPrefix = ""
+				r.HighlightedLines = []LineRange{{Start: 2, End: 2}}
+				r.Overlays = []Overlay{{StartByte: 16, EndByte: 18, Class: "match"}}
+			},
+			expected: `<span class="hl-line"><span class="hl-keyword">func</span> <span class="hl-function">main</span>() {</span>` + "\n" +
+				`<span class="hl-line hl-line-highlighted">` + "\t" + `<span class="hl-keyword">r</span><span class="hl-match"><span class="hl-keyword">et</span></span><span class="hl-keyword">urn</span></span>` + "\n" +
+				`<span class="hl-line">}</span>`,
+		},
+		{
+			name: "highlighted lines with table lines",
+			configure: func(r *HTMLRender) {
+				r.LineMode = LineModeTable
+				r.HighlightedLines = []LineRange{{Start: 3, End: 3}}
+			},
+			expected: `<table class="hl-lines"><tbody>` +
+				`<tr id="L1"><td class="hl-line"><span class="hl-keyword">func</span> <span class="hl-function">main</span>() {</td></tr>` + "\n" +
+				`<tr id="L2"><td class="hl-line">` + "\t" + `<span class="hl-keyword">return</span></td></tr>` + "\n" +
+				`<tr class="hl-line-highlighted" id="L3"><td class="hl-line">}</td></tr>` +
+				`</tbody></table>`,
+		},
+		{
+			name: "class name prefix",
+			configure: func(r *HTMLRender) {
+				r.ClassNamePrefix = "code-"
+				r.LineMode = LineModeSpan
+				r.LineIDPrefix = ""
+				r.HighlightedLines = []LineRange{{Start: 2, End: 2}}
+				r.Overlays = []Overlay{{StartByte: 16, EndByte: 18, Class: "match"}}
+			},
+			expected: `<span class="code-line"><span class="hl-keyword">func</span> <span class="hl-function">main</span>() {</span>` + "\n" +
+				`<span class="code-line code-line-highlighted">` + "\t" + `<span class="hl-keyword">r</span><span class="code-match"><span class="hl-keyword">et</span></span><span class="hl-keyword">urn</span></span>` + "\n" +
+				`<span class="code-line">}</span>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewHTMLRender()
+			tt.configure(r)
+
+			var buf bytes.Buffer
+			err := r.Render(&buf, eventsOf(events...), []byte(source), attributeCallback(captureNames))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, buf.String())
+		})
+	}
+}
@@ -2,9 +2,14 @@ package highlight
 
 import (
 	"fmt"
+	"html"
+	"html/template"
 	"io"
 	"iter"
+	"maps"
 	"slices"
+	"strconv"
+	"strings"
 	"unicode/utf8"
 )
 
@@ -20,89 +25,405 @@ var (
 // This can be anything from classes, ids, or inline styles.
 type AttributeCallback func(h Highlight, languageName string) []byte
 
+// LineMode controls how [HTMLRender] wraps the lines of the source code.
+type LineMode uint8
+
+const (
+	// LineModeNone writes the source code as one continuous stream.
+	LineModeNone LineMode = iota
+	// LineModeSpan wraps each line in a <span> element with the line class. The output is meant to be placed in a <pre> element.
+	LineModeSpan
+	// LineModeTable writes a <table> with one row per line. The line number and the line are written to separate cells,
+	// the line cells need the CSS white-space:pre to keep the indentation.
+	LineModeTable
+)
+
+// InvalidUTF8 controls how [HTMLRender] writes bytes of the source code which are not valid UTF-8.
+type InvalidUTF8 uint8
+
+const (
+	// InvalidUTF8Replace writes each invalid byte as the replacement character U+FFFD.
+	InvalidUTF8Replace InvalidUTF8 = iota
+	// InvalidUTF8Escape writes each invalid byte as a visible escape like \xff in a span with the invalid class.
+	InvalidUTF8Escape
+)
+
+// ControlCharacters controls how [HTMLRender] writes the C0 control characters other than tabs and line breaks, and DEL.
+type ControlCharacters uint8
+
+const (
+	// ControlCharactersKeep writes control characters unchanged.
+	ControlCharactersKeep ControlCharacters = iota
+	// ControlCharactersPicture writes control characters as their symbol of the Unicode Control Pictures block, e.g. ␀ for NUL.
+	ControlCharactersPicture
+	// ControlCharactersEscape writes control characters in caret notation like ^A in a span with the control class.
+	ControlCharactersEscape
+)
+
 // NewHTMLRender returns a new HTMLRender.
 func NewHTMLRender() *HTMLRender {
 	return &HTMLRender{
 		ClassNamePrefix: "hl-",
+		FirstLineNumber: 1,
+		LineIDPrefix:    "L",
 	}
 }
 
 // HTMLRender is a renderer that outputs HTML.
 type HTMLRender struct {
 	ClassNamePrefix string
+	// CSSScope is a selector like ".code" which scopes the rules rendered by [HTMLRender.RenderCSS] to the elements
+	// inside of the matching container. The default style of the theme is rendered for the container itself.
+	CSSScope string
+	// LineMode controls whether each line is wrapped in its own element.
+	// Highlight spans are closed at the end of each line and reopened at the start of the next one,
+	// so the spans of each line are balanced in every mode.
+	LineMode LineMode
+	// LineNumbers adds the line number with a link to the line to each line. It requires a LineMode other than [LineModeNone].
+	LineNumbers bool
+	// FirstLineNumber is the number of the first line, e.g. when rendering an excerpt of a file.
+	FirstLineNumber uint
+	// LineIDPrefix is the prefix of the id of each line element, the default "L" allows linking to lines with #L42.
+	// No ids are written if it is empty.
+	LineIDPrefix string
+	// HighlightedLines are the line numbers of the lines which get the highlighted line class, e.g. to emphasise lines in documentation.
+	// Without a LineMode the highlighted lines are wrapped in a <span> element with the class.
+	HighlightedLines []LineRange
+	// Overlays mark byte ranges of the source code with their own class, e.g. for diagnostics or search results.
+	// Overlay spans enclose the highlight spans, which are split where an overlay starts or ends.
+	Overlays []Overlay
+	// KeepCarriageReturns writes carriage returns instead of dropping them, so CRLF line endings are kept.
+	// Carriage returns which are not followed by a line feed are written as &#13;.
+	KeepCarriageReturns bool
+	// InvalidUTF8 controls how bytes which are not valid UTF-8 are written.
+	// Each invalid byte is written on its own, so the output still corresponds to the bytes of the source code.
+	InvalidUTF8 InvalidUTF8
+	// ControlCharacters controls how control characters are written.
+	ControlCharacters ControlCharacters
+	// TabWidth expands tabs to spaces up to the next multiple of TabWidth columns. Tabs are written unchanged if it is 0.
+	TabWidth int
+	// DocumentTemplate is the template of the documents rendered by [HTMLRender.RenderDocument] and [HTMLRender.RenderThemeDocument].
+	// It is executed with [DocumentData]. If it is nil, [DefaultDocumentTemplate] is used.
+	DocumentTemplate *template.Template
+}
+
+// htmlSpan is an open highlight span.
+type htmlSpan struct {
+	attributes []byte
+	// style is the merged style of the span when rendering inline styles
+	style Style
 }
 
-func (r *HTMLRender) addText(w io.Writer, source []byte, hs []Highlight, languages []string, callback AttributeCallback) error {
-	for len(source) > 0 {
-		c, l := utf8.DecodeRune(source)
-		source = source[l:]
+// htmlWriter writes the escaped source code with the highlight spans and line elements.
+// Spans are only written when text is written inside them.
+type htmlWriter struct {
+	r        *HTMLRender
+	w        io.Writer
+	source   []byte
+	callback AttributeCallback
+	// styleCallback is used instead of the callback to render inline styles
+	styleCallback StyleCallback
+	spans         []htmlSpan
+	// written is the number of spans which have been written in the current line
+	written int
+	inLine  bool
+	line    uint
+	// column is the column of the next rune in the current line, it is used to expand tabs
+	column int
+
+	overlays overlaySet
+	// activeOverlays are the overlays containing the current byte offset
+	activeOverlays []Overlay
+	// overlaysWritten reports whether the active overlays have been written in the current line
+	overlaysWritten bool
+}
 
-		if c == utf8.RuneError || c == '\r' {
-			continue
+func (h *htmlWriter) startSpan(highlight Highlight, languageName string) {
+	var span htmlSpan
+	switch {
+	case h.styleCallback != nil:
+		// merge the style with the surrounding spans, so each span is styled on its own
+		var parent Style
+		if len(h.spans) > 0 {
+			parent = h.spans[len(h.spans)-1].style
 		}
+		span.style = h.styleCallback(highlight, languageName).Inherit(parent)
+		span.attributes = styleAttribute(span.style)
+	case h.callback != nil:
+		span.attributes = h.callback(highlight, languageName)
+	}
+	h.spans = append(h.spans, span)
+}
 
-		if c == '\n' {
-			for range len(hs) - 1 {
-				if err := r.endHighlight(w); err != nil {
-					return err
-				}
+func (h *htmlWriter) endSpan() error {
+	if h.written == len(h.spans) {
+		h.written--
+		if err := h.r.endHighlight(h.w); err != nil {
+			return err
+		}
+	}
+	h.spans = h.spans[:len(h.spans)-1]
+	return nil
+}
+
+// writeText writes the escaped text starting at the byte offset and ends the line at each line break.
+func (h *htmlWriter) writeText(startByte uint, endByte uint) error {
+	offset := startByte
+	for offset < endByte {
+		c, l := utf8.DecodeRune(h.source[offset:endByte])
+
+		if h.overlays.crossBoundary(offset) {
+			if err := h.closeSpans(); err != nil {
+				return err
 			}
+			h.activeOverlays = h.overlays.active(offset)
+		}
+		offset += uint(l)
 
-			if _, err := w.Write([]byte(string(c))); err != nil {
+		switch {
+		case c == '\n':
+			newline := "\n"
+			if h.r.KeepCarriageReturns && offset >= 2 && h.source[offset-2] == '\r' {
+				newline = "\r\n"
+			}
+			if err := h.endLine(); err != nil {
+				return err
+			}
+			if _, err := io.WriteString(h.w, newline); err != nil {
 				return err
 			}
+			continue
+		case c == '\r':
+			// carriage returns of CRLF line endings are written with the line feed
+			if !h.r.KeepCarriageReturns || (int(offset) < len(h.source) && h.source[offset] == '\n') {
+				continue
+			}
+		}
+
+		if err := h.openSpans(); err != nil {
+			return err
+		}
+		if err := h.writeRune(c, h.source[offset-uint(l):offset]); err != nil {
+			return err
+		}
+	}
 
-			nextLanguage, closeLanguage := iter.Pull(slices.Values(languages))
-			defer closeLanguage()
-
-			languageName, _ := nextLanguage()
-			for i, h := range hs {
-				if i == 0 {
-					continue
-				}
-				if err := r.startHighlight(w, h, languageName, callback); err != nil {
-					return err
-				}
-				if h == DefaultHighlight {
-					languageName, _ = nextLanguage()
-				}
+	return nil
+}
+
+// openSpans starts the line and writes the overlay and highlight spans which have not been written in the line yet.
+func (h *htmlWriter) openSpans() error {
+	if err := h.startLine(); err != nil {
+		return err
+	}
+	if !h.overlaysWritten {
+		h.overlaysWritten = true
+		for _, overlay := range h.activeOverlays {
+			if _, err := fmt.Fprintf(h.w, `<span class="%s%s">`, h.r.ClassNamePrefix, html.EscapeString(overlay.Class)); err != nil {
+				return err
 			}
+		}
+	}
+	for ; h.written < len(h.spans); h.written++ {
+		if err := h.r.startHighlight(h.w, h.spans[h.written].attributes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-			continue
+// writeRune writes the escaped rune, which is encoded as the given bytes of the source, using the policies of the [HTMLRender].
+func (h *htmlWriter) writeRune(c rune, encoded []byte) error {
+	var s string
+	width := 1
+	switch {
+	case c == utf8.RuneError && len(encoded) == 1:
+		if h.r.InvalidUTF8 == InvalidUTF8Escape {
+			return h.writeMarker("invalid", fmt.Sprintf(`\x%02x`, encoded[0]))
 		}
+		s = string(utf8.RuneError)
+	case c == '\t' && h.r.TabWidth > 0:
+		width = h.r.TabWidth - h.column%h.r.TabWidth
+		s = strings.Repeat(" ", width)
+	case c == '\r':
+		s = "&#13;"
+		width = 0
+	case isControlCharacter(c) && h.r.ControlCharacters == ControlCharactersPicture:
+		if c == 0x7f {
+			s = "\u2421"
+		} else {
+			s = string(0x2400 + c)
+		}
+	case isControlCharacter(c) && h.r.ControlCharacters == ControlCharactersEscape:
+		return h.writeMarker("control", "^"+string(c^0x40))
+	case c == '&':
+		s = string(escapeAmpersand)
+	case c == '\'':
+		s = string(escapeSingle)
+	case c == '<':
+		s = string(escapeLessThan)
+	case c == '>':
+		s = string(escapeGreaterThan)
+	case c == '"':
+		s = string(escapeDouble)
+	default:
+		s = string(encoded)
+	}
 
-		var b []byte
-		switch c {
-		case '&':
-			b = escapeAmpersand
-		case '\'':
-			b = escapeSingle
-		case '<':
-			b = escapeLessThan
-		case '>':
-			b = escapeGreaterThan
-		case '"':
-			b = escapeDouble
-		default:
-			b = []byte(string(c))
+	h.column += width
+	_, err := io.WriteString(h.w, s)
+	return err
+}
+
+// writeMarker writes a visible replacement of a character in a span with the class.
+func (h *htmlWriter) writeMarker(class string, text string) error {
+	h.column += len(text)
+	_, err := fmt.Fprintf(h.w, `<span class="%s%s">%s</span>`, h.r.ClassNamePrefix, class, html.EscapeString(text))
+	return err
+}
+
+func isControlCharacter(c rune) bool {
+	return (c < 0x20 && c != '\t' && c != '\n' && c != '\r') || c == 0x7f
+}
+
+// startLine writes the start of the line element and the line number if the line has not been started yet.
+func (h *htmlWriter) startLine() error {
+	if h.inLine {
+		return nil
+	}
+	h.inLine = true
+
+	var id string
+	if h.r.LineIDPrefix != "" {
+		id = h.r.LineIDPrefix + strconv.FormatUint(uint64(h.line), 10)
+	}
+
+	var lineNumber string
+	if h.r.LineNumbers {
+		lineNumber = strconv.FormatUint(uint64(h.line), 10)
+		if id != "" {
+			lineNumber = `<a href="#` + html.EscapeString(id) + `">` + lineNumber + `</a>`
+		}
+	}
+
+	var highlightedClass string
+	if isHighlightedLine(h.r.HighlightedLines, h.line) {
+		highlightedClass = h.r.ClassNamePrefix + "line-highlighted"
+	}
+
+	var err error
+	switch h.r.LineMode {
+	case LineModeNone:
+		if highlightedClass != "" {
+			_, err = fmt.Fprintf(h.w, `<span class="%s">`, highlightedClass)
 		}
+	case LineModeSpan:
+		_, err = fmt.Fprintf(h.w, `<span class="%s"%s>`, joinClasses(h.r.ClassNamePrefix+"line", highlightedClass), idAttribute(id))
+		if err == nil && h.r.LineNumbers {
+			_, err = fmt.Fprintf(h.w, `<span class="%sline-number">%s</span>`, h.r.ClassNamePrefix, lineNumber)
+		}
+	case LineModeTable:
+		_, err = fmt.Fprintf(h.w, `<tr%s%s>`, classAttribute(highlightedClass), idAttribute(id))
+		if err == nil && h.r.LineNumbers {
+			_, err = fmt.Fprintf(h.w, `<td class="%sline-number">%s</td>`, h.r.ClassNamePrefix, lineNumber)
+		}
+		if err == nil {
+			_, err = fmt.Fprintf(h.w, `<td class="%sline">`, h.r.ClassNamePrefix)
+		}
+	}
+	return err
+}
+
+// endLine closes the written spans and the line element. Empty lines are started first so every line gets an element.
+func (h *htmlWriter) endLine() error {
+	if err := h.startLine(); err != nil {
+		return err
+	}
+	if err := h.closeSpans(); err != nil {
+		return err
+	}
+
+	highlighted := isHighlightedLine(h.r.HighlightedLines, h.line)
+	h.inLine = false
+	h.line++
+	h.column = 0
 
-		if _, err := w.Write(b); err != nil {
+	var err error
+	switch h.r.LineMode {
+	case LineModeNone:
+		if highlighted {
+			_, err = io.WriteString(h.w, "</span>")
+		}
+	case LineModeSpan:
+		_, err = io.WriteString(h.w, "</span>")
+	case LineModeTable:
+		_, err = io.WriteString(h.w, "</td></tr>")
+	}
+	return err
+}
+
+// closeSpans closes the written highlight and overlay spans, they are reopened before the next text is written.
+func (h *htmlWriter) closeSpans() error {
+	for ; h.written > 0; h.written-- {
+		if err := h.r.endHighlight(h.w); err != nil {
 			return err
 		}
 	}
 
+	if h.overlaysWritten {
+		h.overlaysWritten = false
+		for range h.activeOverlays {
+			if err := h.r.endHighlight(h.w); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
-func (r *HTMLRender) startHighlight(w io.Writer, h Highlight, languageName string, callback AttributeCallback) error {
-	if _, err := fmt.Fprintf(w, "<span"); err != nil {
-		return err
+// close ends the last line if it has content.
+func (h *htmlWriter) close() error {
+	if !h.inLine {
+		return nil
 	}
+	return h.endLine()
+}
 
-	var attributes []byte
-	if callback != nil {
-		attributes = callback(h, languageName)
+func classAttribute(class string) string {
+	if class == "" {
+		return ""
+	}
+	return ` class="` + html.EscapeString(class) + `"`
+}
+
+func joinClasses(class string, other string) string {
+	if other == "" {
+		return class
+	}
+	return class + " " + other
+}
+
+func idAttribute(id string) string {
+	if id == "" {
+		return ""
+	}
+	return ` id="` + html.EscapeString(id) + `"`
+}
+
+func styleAttribute(style Style) []byte {
+	if style.IsZero() {
+		return nil
+	}
+	return []byte(`style="` + style.CSS() + `"`)
+}
+
+func (r *HTMLRender) startHighlight(w io.Writer, attributes []byte) error {
+	return r.startHighlightElement(w, "span", attributes)
+}
+
+func (r *HTMLRender) startHighlightElement(w io.Writer, element string, attributes []byte) error {
+	if _, err := io.WriteString(w, "<"+element); err != nil {
+		return err
 	}
 
 	if len(attributes) > 0 {
@@ -125,11 +446,56 @@ func (r *HTMLRender) endHighlight(w io.Writer) error {
 
 // Render renders the code code to the writer with spans for each highlight capture.
 // The [AttributeCallback] is used to generate the classes or inline styles for each span.
+// Depending on the [LineMode] each line is wrapped in its own element, see [HTMLRender].
 func (r *HTMLRender) Render(w io.Writer, events iter.Seq2[Event, error], source []byte, callback AttributeCallback) error {
-	var (
-		highlights []Highlight
-		languages  []string
-	)
+	return r.render(&htmlWriter{
+		r:        r,
+		w:        w,
+		source:   source,
+		callback: callback,
+		line:     r.FirstLineNumber,
+		overlays: newOverlaySet(r.Overlays),
+	}, events)
+}
+
+// RenderInline renders the code to the writer as a self-contained <pre> element with inline styles instead of classes,
+// e.g. for emails or Markdown where <style> elements are removed.
+// The style of each span is resolved from the theme and merged with the styles of the surrounding spans.
+// The <pre> element has the default style of the theme. Line elements and overlays keep their classes,
+// so [LineModeTable] should not be used.
+func (r *HTMLRender) RenderInline(w io.Writer, events iter.Seq2[Event, error], source []byte, theme *Theme, captureNames []string) error {
+	if err := r.startHighlightElement(w, "pre", styleAttribute(theme.Default)); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, "<code>"); err != nil {
+		return err
+	}
+
+	err := r.render(&htmlWriter{
+		r:             r,
+		w:             w,
+		source:        source,
+		styleCallback: theme.StyleCallback(captureNames),
+		line:          r.FirstLineNumber,
+		overlays:      newOverlaySet(r.Overlays),
+	}, events)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "</code></pre>")
+	return err
+}
+
+func (r *HTMLRender) render(hw *htmlWriter, events iter.Seq2[Event, error]) error {
+	w := hw.w
+	if r.LineMode == LineModeTable {
+		if _, err := fmt.Fprintf(w, `<table class="%slines"><tbody>`, r.ClassNamePrefix); err != nil {
+			return err
+		}
+	}
+
+	var languageName string
 	for event, err := range events {
 		if err != nil {
 			return fmt.Errorf("error while rendering: %w", err)
@@ -137,86 +503,179 @@ func (r *HTMLRender) Render(w io.Writer, events iter.Seq2[Event, error], source
 
 		switch e := event.(type) {
 		case EventLayerStart:
-			highlights = append(highlights, DefaultHighlight)
-			languages = append(languages, e.LanguageName)
+			languageName = e.LanguageName
 		case EventLayerEnd:
-			highlights = highlights[:len(highlights)-1]
-			languages = languages[:len(languages)-1]
+			languageName = ""
 		case EventCaptureStart:
-			highlights = append(highlights, e.Highlight)
-			language := languages[len(languages)-1]
-			if err = r.startHighlight(w, e.Highlight, language, callback); err != nil {
-				return fmt.Errorf("error while starting highlight: %w", err)
-			}
+			hw.startSpan(e.Highlight, languageName)
 		case EventCaptureEnd:
-			highlights = highlights[:len(highlights)-1]
-			if err = r.endHighlight(w); err != nil {
+			if err = hw.endSpan(); err != nil {
 				return fmt.Errorf("error while ending highlight: %w", err)
 			}
 		case EventSource:
-			if err = r.addText(w, source[e.StartByte:e.EndByte], highlights, languages, callback); err != nil {
+			if err = hw.writeText(e.StartByte, e.EndByte); err != nil {
 				return fmt.Errorf("error while writing source: %w", err)
 			}
 		}
 	}
 
+	if err := hw.close(); err != nil {
+		return fmt.Errorf("error while ending line: %w", err)
+	}
+
+	if r.LineMode == LineModeTable {
+		if _, err := io.WriteString(w, "</tbody></table>"); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-// RenderCSS renders the css classes for a theme to the writer.
+// RenderCSS renders the css classes for a theme to the writer. The theme maps capture names to CSS declarations
+// like "color:#ff0000;". The rules are sorted by name, so the output is the same for the same theme.
+// Use [HTMLRender.RenderThemeCSS] to render the css classes of a [Theme].
 func (r *HTMLRender) RenderCSS(w io.Writer, theme map[string]string) error {
-	for name, style := range theme {
-		_, err := fmt.Fprintf(w, ".%s%s{%s}", r.ClassNamePrefix, name, style)
-		if err != nil {
+	for _, name := range slices.Sorted(maps.Keys(theme)) {
+		if _, err := fmt.Fprintf(w, "%s{%s}", r.cssSelector(r.ClassNamePrefix+name), theme[name]); err != nil {
 			return err
 		}
 	}
+	return nil
+}
+
+// RenderThemeCSS renders the css classes for a theme to the writer. A rule is rendered for each capture name of the theme.
+// Language specific styles of the theme are rendered for spans which also have the class of the language, see [HTMLRender.ThemeAttributeCallback].
+// The rules are sorted by name, so the output is the same for the same theme.
+func (r *HTMLRender) RenderThemeCSS(w io.Writer, theme *Theme) error {
+	return r.renderThemeCSS(w, theme, nil)
+}
+
+// RenderCSSForNames is like [HTMLRender.RenderThemeCSS] but renders a rule for each of the capture names the configurations
+// were configured with, using the style the name resolves to in the theme, see [Theme.Resolve].
+// This covers names like "function.builtin.static" which only get a style through the fallback to a parent name.
+// If captureNames is nil, the names of the theme are used.
+func (r *HTMLRender) RenderCSSForNames(w io.Writer, theme *Theme, captureNames []string) error {
+	return r.renderThemeCSS(w, theme, captureNames)
+}
 
+// RenderColorSchemeCSS renders the css classes of a light and a dark theme to the writer, each wrapped in a
+// prefers-color-scheme media query, so the theme follows the color scheme of the browser or operating system.
+// The rules are rendered like [HTMLRender.RenderCSSForNames]. Use [HTMLRender.ThemesAttributeCallback] with both themes to set the classes.
+func (r *HTMLRender) RenderColorSchemeCSS(w io.Writer, light *Theme, dark *Theme, captureNames []string) error {
+	for _, scheme := range []struct {
+		name  string
+		theme *Theme
+	}{
+		{"light", light},
+		{"dark", dark},
+	} {
+		if _, err := fmt.Fprintf(w, "@media (prefers-color-scheme: %s){", scheme.name); err != nil {
+			return err
+		}
+		if err := r.renderThemeCSS(w, scheme.theme, captureNames); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, "}"); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (r *HTMLRender) themeAttributeCallback(captureNames []string) AttributeCallback {
-	return func(h Highlight, languageName string) []byte {
-		if h == DefaultHighlight {
-			return nil
+func (r *HTMLRender) renderThemeCSS(w io.Writer, theme *Theme, captureNames []string) error {
+	if captureNames == nil {
+		captureNames = theme.Names()
+	}
+	names := slices.Compact(slices.Sorted(slices.Values(captureNames)))
+
+	if r.CSSScope != "" && !theme.Default.IsZero() {
+		if _, err := fmt.Fprintf(w, "%s{%s}", r.CSSScope, theme.Default.CSS()); err != nil {
+			return err
 		}
+	}
 
-		return []byte(fmt.Sprintf(`class="%s%s"`, r.ClassNamePrefix, captureNames[h]))
+	for _, name := range names {
+		style, ok := theme.Resolve(name, "")
+		if !ok {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s{%s}", r.cssSelector(r.ClassNamePrefix+name), style.CSS()); err != nil {
+			return err
+		}
 	}
 
+	for _, languageName := range slices.Sorted(maps.Keys(theme.Languages)) {
+		for _, name := range names {
+			if !theme.hasLanguageStyle(name, languageName) {
+				continue
+			}
+			style, _ := theme.Resolve(name, languageName)
+			if _, err := fmt.Fprintf(w, "%s{%s}", r.cssSelector(r.ClassNamePrefix+name, r.languageClassPrefix()+languageName), style.CSS()); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
 }
 
-// RenderDocument renders a full HTML document with the code and theme embedded.
-func (r *HTMLRender) RenderDocument(w io.Writer, events iter.Seq2[Event, error], title string, source []byte, captureNames []string, theme map[string]string) error {
-	if _, err := fmt.Fprintf(w, `<!DOCTYPE html>
-<html>
-<head>
-<meta charset="utf-8">
-<title>%s</title>
-<style>
-`, title); err != nil {
-		return err
+// cssSelector returns the selector for elements with all the classes inside the CSSScope.
+func (r *HTMLRender) cssSelector(classes ...string) string {
+	var b strings.Builder
+	if r.CSSScope != "" {
+		b.WriteString(r.CSSScope + " ")
 	}
-
-	if err := r.RenderCSS(w, theme); err != nil {
-		return err
+	for _, class := range classes {
+		b.WriteString("." + escapeCSSIdentifier(class))
 	}
+	return b.String()
+}
 
-	if _, err := fmt.Fprintf(w, `</style>
-</head>
-<body>
-<pre><code>
-`); err != nil {
-		return err
+// escapeCSSIdentifier escapes the characters of a class name which are not allowed in a CSS identifier,
+// e.g. the dots of capture names like "function.builtin".
+func escapeCSSIdentifier(s string) string {
+	var b strings.Builder
+	for i, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == '-', c >= 0x80:
+			b.WriteRune(c)
+		case c >= '0' && c <= '9' && i > 0:
+			b.WriteRune(c)
+		case c >= '0' && c <= '9':
+			fmt.Fprintf(&b, "\\%x ", c)
+		default:
+			b.WriteString("\\" + string(c))
+		}
 	}
+	return b.String()
+}
 
-	if err := r.Render(w, events, source, r.themeAttributeCallback(captureNames)); err != nil {
-		return err
+// ThemeAttributeCallback returns an [AttributeCallback] which sets the classes rendered by [HTMLRender.RenderThemeCSS]
+// using the capture names the configurations were configured with.
+// Spans whose capture has a language specific style in the theme also get the class of the language.
+func (r *HTMLRender) ThemeAttributeCallback(theme *Theme, captureNames []string) AttributeCallback {
+	return r.ThemesAttributeCallback([]*Theme{theme}, captureNames)
+}
+
+// ThemesAttributeCallback is like [HTMLRender.ThemeAttributeCallback] for multiple themes, e.g. the light and dark
+// theme rendered by [HTMLRender.RenderColorSchemeCSS].
+// Spans whose capture has a language specific style in any of the themes also get the class of the language.
+func (r *HTMLRender) ThemesAttributeCallback(themes []*Theme, captureNames []string) AttributeCallback {
+	return func(h Highlight, languageName string) []byte {
+		if h == DefaultHighlight || int(h) >= len(captureNames) {
+			return nil
+		}
+
+		for _, theme := range themes {
+			if theme.hasLanguageStyle(captureNames[h], languageName) {
+				return []byte(fmt.Sprintf(`class="%s%s %s%s"`, r.ClassNamePrefix, captureNames[h], r.languageClassPrefix(), languageName))
+			}
+		}
+		return []byte(fmt.Sprintf(`class="%s%s"`, r.ClassNamePrefix, captureNames[h]))
 	}
+}
 
-	_, err := fmt.Fprintf(w, `</code></pre>
-</body>
-</html>
-`)
-	return err
+func (r *HTMLRender) languageClassPrefix() string {
+	return r.ClassNamePrefix + "lang-"
 }
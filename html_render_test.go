@@ -1,9 +1,11 @@
 package highlight
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -43,7 +45,7 @@ func TestHTMLRender_Render(t *testing.T) {
 
 	language := tree_sitter.NewLanguage(tree_sitter_go.Language())
 
-	highlightsQuery, err := os.ReadFile("testdata/highlights.scm")
+	highlightsQuery, err := os.ReadFile("testdata/queries/go/highlights.scm")
 	require.NoError(t, err)
 
 	cfg, err := NewConfiguration(language, "go", highlightsQuery, nil, nil)
@@ -94,3 +96,372 @@ func TestHTMLRender_Render(t *testing.T) {
 `)
 	require.NoError(t, err)
 }
+
+func TestHTMLRender_RenderLines(t *testing.T) {
+	source := "a<b\n\n/*c\nd*/\n"
+	events := []Event{
+		EventLayerStart{LanguageName: "go"},
+		EventSource{StartByte: 0, EndByte: 3},
+		EventSource{StartByte: 3, EndByte: 5},
+		EventCaptureStart{Highlight: 0},
+		EventSource{StartByte: 5, EndByte: 12},
+		EventCaptureEnd{},
+		EventSource{StartByte: 12, EndByte: 13},
+	}
+	captureNames := []string{"comment"}
+
+	tests := []struct {
+		name      string
+		configure func(r *HTMLRender)
+		expected  string
+	}{
+		{
+			name:      "no line mode",
+			configure: func(r *HTMLRender) {},
+			expected:  "a&lt;b\n\n<span class=\"hl-comment\">/*c</span>\n<span class=\"hl-comment\">d*/</span>\n",
+		},
+		{
+			name: "span lines",
+			configure: func(r *HTMLRender) {
+				r.LineMode = LineModeSpan
+			},
+			expected: `<span class="hl-line" id="L1">a&lt;b</span>` + "\n" +
+				`<span class="hl-line" id="L2"></span>` + "\n" +
+				`<span class="hl-line" id="L3"><span class="hl-comment">/*c</span></span>` + "\n" +
+				`<span class="hl-line" id="L4"><span class="hl-comment">d*/</span></span>` + "\n",
+		},
+		{
+			name: "span lines with line numbers",
+			configure: func(r *HTMLRender) {
+				r.LineMode = LineModeSpan
+				r.LineNumbers = true
+				r.FirstLineNumber = 41
+			},
+			expected: `<span class="hl-line" id="L41"><span class="hl-line-number"><a href="#L41">41</a></span>a&lt;b</span>` + "\n" +
+				`<span class="hl-line" id="L42"><span class="hl-line-number"><a href="#L42">42</a></span></span>` + "\n" +
+				`<span class="hl-line" id="L43"><span class="hl-line-number"><a href="#L43">43</a></span><span class="hl-comment">/*c</span></span>` + "\n" +
+				`<span class="hl-line" id="L44"><span class="hl-line-number"><a href="#L44">44</a></span><span class="hl-comment">d*/</span></span>` + "\n",
+		},
+		{
+			name: "table lines without ids",
+			configure: func(r *HTMLRender) {
+				r.LineMode = LineModeTable
+				r.LineNumbers = true
+				r.LineIDPrefix = ""
+			},
+			expected: `<table class="hl-lines"><tbody>` +
+				`<tr><td class="hl-line-number">1</td><td class="hl-line">a&lt;b</td></tr>` + "\n" +
+				`<tr><td class="hl-line-number">2</td><td class="hl-line"></td></tr>` + "\n" +
+				`<tr><td class="hl-line-number">3</td><td class="hl-line"><span class="hl-comment">/*c</span></td></tr>` + "\n" +
+				`<tr><td class="hl-line-number">4</td><td class="hl-line"><span class="hl-comment">d*/</span></td></tr>` + "\n" +
+				`</tbody></table>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewHTMLRender()
+			tt.configure(r)
+
+			var buf bytes.Buffer
+			err := r.Render(&buf, eventsOf(events...), []byte(source), attributeCallback(captureNames))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, buf.String())
+		})
+	}
+}
+
+func TestHTMLRender_RenderLinesBalanced(t *testing.T) {
+	source := []byte("<div>\n<script>\nlet s = `a\nb`; /* multi\nline */\n</script>\n<style>\na {\n  color: red;\n}\n</style>\n</div>\n")
+	cfg := loadTestConfiguration(t, "html")
+
+	r := NewHTMLRender()
+	r.LineMode = LineModeSpan
+
+	var buf bytes.Buffer
+	events := New().Highlight(context.Background(), *cfg, source, testInjectionCallback(t))
+	err := r.Render(&buf, events, source, attributeCallback(StandardCaptureNames))
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	assert.Len(t, lines, bytes.Count(source, []byte("\n")))
+	for _, line := range lines {
+		assert.Equal(t, strings.Count(line, "<span"), strings.Count(line, "</span>"), line)
+	}
+}
+
+func TestHTMLRender_RenderInline(t *testing.T) {
+	source := `f("a\n")`
+	captureNames := []string{"function", "string", "string.escape", "variable"}
+	events := []Event{
+		EventLayerStart{LanguageName: "go"},
+		EventCaptureStart{Highlight: 0},
+		EventSource{StartByte: 0, EndByte: 1},
+		EventCaptureEnd{},
+		EventSource{StartByte: 1, EndByte: 2},
+		EventCaptureStart{Highlight: 1},
+		EventSource{StartByte: 2, EndByte: 4},
+		EventCaptureStart{Highlight: 2},
+		EventSource{StartByte: 4, EndByte: 6},
+		EventCaptureEnd{},
+		EventCaptureStart{Highlight: 3},
+		EventSource{StartByte: 6, EndByte: 7},
+		EventCaptureEnd{},
+		EventCaptureEnd{},
+		EventSource{StartByte: 7, EndByte: 8},
+	}
+
+	theme := &Theme{
+		Default: Style{Foreground: RGBColor(0xee, 0xee, 0xee), Background: RGBColor(0x11, 0x11, 0x11)},
+		Styles: map[string]Style{
+			"function":      {Foreground: RGBColor(0xff, 0x00, 0x00)},
+			"string":        {Foreground: RGBColor(0x00, 0xff, 0x00), Italic: true},
+			"string.escape": {Bold: true},
+		},
+		Languages: map[string]map[string]Style{
+			"go": {"function": {Underline: true}},
+		},
+	}
+
+	var buf bytes.Buffer
+	err := NewHTMLRender().RenderInline(&buf, eventsOf(events...), []byte(source), theme, captureNames)
+	require.NoError(t, err)
+	assert.Equal(t, `<pre style="color:#eeeeee;background-color:#111111;"><code>`+
+		`<span style="text-decoration:underline;">f</span>(`+
+		`<span style="color:#00ff00;font-style:italic;">&#34;a`+
+		`<span style="color:#00ff00;font-weight:bold;font-style:italic;">\n</span>`+
+		`<span style="color:#00ff00;font-style:italic;">&#34;</span>`+
+		`</span>)</code></pre>`, buf.String())
+}
+
+func TestHTMLRender_RenderCharacters(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    string
+		configure func(r *HTMLRender)
+		expected  string
+	}{
+		{
+			name:      "drop carriage returns",
+			source:    "a\r\nb\rc",
+			configure: func(r *HTMLRender) {},
+			expected:  `<span class="hl-string">a</span>` + "\n" + `<span class="hl-string">bc</span>`,
+		},
+		{
+			name:   "keep carriage returns",
+			source: "a\r\nb\rc\r",
+			configure: func(r *HTMLRender) {
+				r.KeepCarriageReturns = true
+			},
+			expected: `<span class="hl-string">a</span>` + "\r\n" + `<span class="hl-string">b&#13;c&#13;</span>`,
+		},
+		{
+			name:   "keep carriage returns with span lines",
+			source: "a\r\n\r\n",
+			configure: func(r *HTMLRender) {
+				r.KeepCarriageReturns = true
+				r.LineMode = LineModeSpan
+				r.LineIDPrefix = ""
+			},
+			expected: `<span class="hl-line"><span class="hl-string">a</span></span>` + "\r\n" + `<span class="hl-line"></span>` + "\r\n",
+		},
+		{
+			name:      "replace invalid utf-8",
+			source:    "caf\xe9 \xff\xfe �",
+			configure: func(r *HTMLRender) {},
+			expected:  `<span class="hl-string">caf` + "� �� �" + `</span>`,
+		},
+		{
+			name:   "escape invalid utf-8",
+			source: "caf\xe9 �",
+			configure: func(r *HTMLRender) {
+				r.InvalidUTF8 = InvalidUTF8Escape
+			},
+			expected: `<span class="hl-string">caf<span class="hl-invalid">\xe9</span> ` + "�" + `</span>`,
+		},
+		{
+			name:      "keep control characters",
+			source:    "a\x00\x1b\x7f",
+			configure: func(r *HTMLRender) {},
+			expected:  "<span class=\"hl-string\">a\x00\x1b\x7f</span>",
+		},
+		{
+			name:   "control pictures",
+			source: "a\x00\x1b\x7f",
+			configure: func(r *HTMLRender) {
+				r.ControlCharacters = ControlCharactersPicture
+			},
+			expected: `<span class="hl-string">a␀␛␡</span>`,
+		},
+		{
+			name:   "escape control characters",
+			source: "a\x00\x7f",
+			configure: func(r *HTMLRender) {
+				r.ControlCharacters = ControlCharactersEscape
+			},
+			expected: `<span class="hl-string">a<span class="hl-control">^@</span><span class="hl-control">^?</span></span>`,
+		},
+		{
+			name:   "expand tabs",
+			source: "\tab\tc\n12345\t6",
+			configure: func(r *HTMLRender) {
+				r.TabWidth = 4
+			},
+			expected: `<span class="hl-string">    ab  c</span>` + "\n" + `<span class="hl-string">12345   6</span>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewHTMLRender()
+			tt.configure(r)
+
+			events := eventsOf(
+				EventLayerStart{LanguageName: "go"},
+				EventCaptureStart{Highlight: 0},
+				EventSource{StartByte: 0, EndByte: uint(len(tt.source))},
+				EventCaptureEnd{},
+			)
+
+			var buf bytes.Buffer
+			err := r.Render(&buf, events, []byte(tt.source), attributeCallback([]string{"string"}))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, buf.String())
+		})
+	}
+}
+
+func TestHTMLRender_RenderThemeCSS(t *testing.T) {
+	tests := []struct {
+		name         string
+		cssScope     string
+		captureNames []string
+		expected     string
+	}{
+		{
+			name: "theme names",
+			expected: ".hl-function{color:#73fbf1;}" +
+				`.hl-function\.builtin{color:#73fbf1;font-style:italic;}` +
+				".hl-keyword{color:#a578ea;font-weight:bold;}" +
+				".hl-string{color:#b8e466;}" +
+				`.hl-string\.escape{color:#b8e466;}` +
+				".hl-function.hl-lang-go{color:#ff0000;}" +
+				`.hl-string\.escape.hl-lang-go{color:#00ff00;}` +
+				`.hl-type\.definition.hl-lang-go{text-decoration:underline;}`,
+		},
+		{
+			name:         "recognized names",
+			captureNames: []string{"keyword.return", "function.method", "variable", "function.builtin.static", "keyword.return"},
+			expected: `.hl-function\.builtin\.static{color:#73fbf1;font-style:italic;}` +
+				`.hl-function\.method{color:#73fbf1;}` +
+				`.hl-keyword\.return{color:#a578ea;font-weight:bold;}` +
+				`.hl-function\.method.hl-lang-go{color:#ff0000;}`,
+		},
+		{
+			name:         "scope",
+			cssScope:     ".code",
+			captureNames: []string{"keyword", "string.escape"},
+			expected: ".code{color:#eeeeee;background-color:#111111;}" +
+				".code .hl-keyword{color:#a578ea;font-weight:bold;}" +
+				`.code .hl-string\.escape{color:#b8e466;}` +
+				`.code .hl-string\.escape.hl-lang-go{color:#00ff00;}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewHTMLRender()
+			r.CSSScope = tt.cssScope
+
+			var buf bytes.Buffer
+			err := r.RenderCSSForNames(&buf, testTheme, tt.captureNames)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, buf.String())
+
+			// the output is deterministic
+			var buf2 bytes.Buffer
+			err = r.RenderCSSForNames(&buf2, testTheme, tt.captureNames)
+			require.NoError(t, err)
+			assert.Equal(t, buf.String(), buf2.String())
+
+			// RenderThemeCSS renders the names of the theme
+			if tt.captureNames == nil {
+				var buf3 bytes.Buffer
+				err = r.RenderThemeCSS(&buf3, testTheme)
+				require.NoError(t, err)
+				assert.Equal(t, buf.String(), buf3.String())
+			}
+		})
+	}
+}
+
+func TestHTMLRender_RenderColorSchemeCSS(t *testing.T) {
+	light := &Theme{
+		Default: Style{Background: RGBColor(0xff, 0xff, 0xff)},
+		Styles: map[string]Style{
+			"keyword": {Foreground: RGBColor(0x00, 0x00, 0xff)},
+		},
+	}
+
+	r := NewHTMLRender()
+	r.CSSScope = "pre"
+
+	var buf bytes.Buffer
+	err := r.RenderColorSchemeCSS(&buf, light, testTheme, []string{"keyword", "function"})
+	require.NoError(t, err)
+	assert.Equal(t, "@media (prefers-color-scheme: light){"+
+		"pre{background-color:#ffffff;}"+
+		"pre .hl-keyword{color:#0000ff;}"+
+		"}"+
+		"@media (prefers-color-scheme: dark){"+
+		"pre{color:#eeeeee;background-color:#111111;}"+
+		"pre .hl-function{color:#73fbf1;}"+
+		"pre .hl-keyword{color:#a578ea;font-weight:bold;}"+
+		"pre .hl-function.hl-lang-go{color:#ff0000;}"+
+		"}", buf.String())
+
+	// the language class is set if any of the themes has a language specific style
+	callback := r.ThemesAttributeCallback([]*Theme{light, testTheme}, []string{"keyword", "function"})
+	assert.Equal(t, `class="hl-function hl-lang-go"`, string(callback(1, "go")))
+	assert.Equal(t, `class="hl-keyword"`, string(callback(0, "go")))
+}
+
+func TestEscapeCSSIdentifier(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "hl-keyword", expected: "hl-keyword"},
+		{input: "hl-function.builtin", expected: `hl-function\.builtin`},
+		{input: "1st", expected: `\31 st`},
+		{input: "a+b", expected: `a\+b`},
+		{input: "ünicode", expected: "ünicode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			assert.Equal(t, tt.expected, escapeCSSIdentifier(tt.input))
+		})
+	}
+}
+
+func TestHTMLRender_ThemeAttributeCallback(t *testing.T) {
+	captureNames := testTheme.Names()
+	callback := NewHTMLRender().ThemeAttributeCallback(testTheme, captureNames)
+
+	assert.Nil(t, callback(DefaultHighlight, "go"))
+	assert.Equal(t, `class="hl-keyword"`, string(callback(2, "go")))
+	assert.Equal(t, `class="hl-function hl-lang-go"`, string(callback(0, "go")))
+	assert.Equal(t, `class="hl-function"`, string(callback(0, "javascript")))
+	assert.Equal(t, `class="hl-function.builtin"`, string(callback(1, "go")))
+}
+
+func TestHTMLRender_RenderCSS(t *testing.T) {
+	var buf bytes.Buffer
+	err := NewHTMLRender().RenderCSS(&buf, map[string]string{
+		"keyword":          "font-weight:bold;",
+		"function.builtin": "color:#ff0000;",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `.hl-function\.builtin{color:#ff0000;}.hl-keyword{font-weight:bold;}`, buf.String())
+}
@@ -0,0 +1,28 @@
+// Package textpos counts positions in UTF-8 source code for the packages of the module.
+package textpos
+
+import (
+	"unicode/utf8"
+)
+
+// UTF16Length returns the number of UTF-16 code units of the UTF-8 text.
+// Invalid bytes count as one code unit each, like the replacement character they are decoded to.
+func UTF16Length(text []byte) uint {
+	var n uint
+	for len(text) > 0 {
+		if text[0] < utf8.RuneSelf {
+			n++
+			text = text[1:]
+			continue
+		}
+
+		r, size := utf8.DecodeRune(text)
+		text = text[size:]
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
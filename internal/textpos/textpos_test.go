@@ -0,0 +1,29 @@
+package textpos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUTF16Length(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected uint
+	}{
+		{name: "empty", text: "", expected: 0},
+		{name: "ascii", text: "abc", expected: 3},
+		{name: "two byte", text: "äö", expected: 2},
+		{name: "three byte", text: "€", expected: 1},
+		{name: "surrogate pair", text: "a😀b", expected: 4},
+		{name: "invalid bytes", text: "a\xff\xfeb", expected: 4},
+		{name: "truncated rune", text: "\xe2\x82", expected: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, UTF16Length([]byte(tt.text)))
+		})
+	}
+}
@@ -18,7 +18,11 @@ type iterator struct {
 	Source             []byte
 	LanguageName       string
 	ByteOffset         uint
+	Position           sourcePosition
+	StartByte          uint
+	EndByte            uint
 	Highlighter        *Highlighter
+	ParseLayer         layerParser
 	InjectionCallback  InjectionCallback
 	Layers             []*iterLayer
 	NextEvents         []Event
@@ -26,25 +30,63 @@ type iterator struct {
 	LastLayer          *iterLayer
 }
 
+// emitEvents returns the source up to the offset if there is any, otherwise the first of the events.
+// The remaining events are queued. Without events and source it returns nil, which ends the iteration.
+// A pending switch to the current layer is emitted first, see [iterator.switchLayer].
 func (h *iterator) emitEvents(offset uint, events ...Event) (Event, error) {
+	// Never emit source code after the end of the highlighted range.
+	offset = min(offset, h.EndByte)
+
+	if len(h.Layers) > 0 && h.Layers[0] != h.LastLayer {
+		switchEvents := h.switchLayer(h.Layers[0])
+		if h.ByteOffset < offset {
+			switchEvents = append(switchEvents, h.sourceEvent(offset))
+		}
+		h.NextEvents = append(h.NextEvents, append(switchEvents[1:], events...)...)
+		h.sortLayers()
+		return switchEvents[0], nil
+	}
+
 	var result Event
 	if h.ByteOffset < offset {
-		result = EventSource{
-			StartByte: h.ByteOffset,
-			EndByte:   offset,
-		}
-		h.ByteOffset = offset
+		result = h.sourceEvent(offset)
 		h.NextEvents = append(h.NextEvents, events...)
-	} else {
-		if len(events) > 1 {
-			h.NextEvents = append(h.NextEvents, events[1:]...)
-		}
+	} else if len(events) > 0 {
+		h.NextEvents = append(h.NextEvents, events[1:]...)
 		result = events[0]
 	}
 	h.sortLayers()
 	return result, nil
 }
 
+// switchLayer returns the events switching from the last layer to the layer.
+func (h *iterator) switchLayer(layer *iterLayer) []Event {
+	var events []Event
+	if h.LastLayer != nil {
+		events = append(events, EventLayerEnd{})
+	}
+	h.LastLayer = layer
+	return append(events, EventLayerStart{
+		LanguageName: layer.Config.LanguageName,
+	})
+}
+
+// sourceEvent returns the [EventSource] from the current byte offset to the given offset and advances to it.
+func (h *iterator) sourceEvent(offset uint) EventSource {
+	end := h.Position.advance(h.Source[h.ByteOffset:offset])
+	event := EventSource{
+		StartByte:        h.ByteOffset,
+		EndByte:          offset,
+		StartPoint:       h.Position.Point,
+		EndPoint:         end.Point,
+		StartUTF16Column: h.Position.UTF16Column,
+		EndUTF16Column:   end.UTF16Column,
+	}
+	h.ByteOffset = offset
+	h.Position = end
+	return event
+}
+
 func (h *iterator) next() (Event, error) {
 main:
 	for {
@@ -63,30 +105,19 @@ main:
 
 		// If none of the layers have any more highlight boundaries, terminate.
 		if len(h.Layers) == 0 {
-			if h.ByteOffset < uint(len(h.Source)) {
-				event := EventSource{
-					StartByte: h.ByteOffset,
-					EndByte:   uint(len(h.Source)),
-				}
-				h.ByteOffset = uint(len(h.Source))
-				return event, nil
+			if h.ByteOffset < h.EndByte {
+				return h.sourceEvent(h.EndByte), nil
 			}
 
 			return nil, nil
 		}
 
 		// Get the next capture from whichever layer has the earliest highlight boundary.
+		// Switching to a layer whose next boundary is before the highlighted range is deferred until it emits an event,
+		// as most of its captures before the range are skipped.
 		layer := h.Layers[0]
-		if layer != h.LastLayer {
-			var events []Event
-			if h.LastLayer != nil {
-				events = append(events, EventLayerEnd{})
-			}
-			h.LastLayer = layer
-
-			return h.emitEvents(h.ByteOffset, append(events, EventLayerStart{
-				LanguageName: layer.Config.LanguageName,
-			})...)
+		if layer != h.LastLayer && layer.sortKey().offset >= h.StartByte {
+			return h.emitEvents(h.ByteOffset, h.switchLayer(layer)...)
 		}
 
 		var nextCaptureRange tree_sitter.Range
@@ -112,7 +143,7 @@ main:
 				layer.HighlightEndStack = layer.HighlightEndStack[:len(layer.HighlightEndStack)-1]
 				return h.emitEvents(endByte, EventCaptureEnd{})
 			}
-			return h.emitEvents(uint(len(h.Source)), nil)
+			return h.emitEvents(h.EndByte)
 		}
 
 		match, captureIndex, _ := layer.Captures.Next()
@@ -127,13 +158,13 @@ main:
 			match.Remove()
 
 			// If a language is found with the given name, then add a new language layer
-			// to the highlighted document.
-			if languageName != "" && contentNode != nil {
+			// to the highlighted document. Injections before the highlighted range are skipped.
+			if languageName != "" && contentNode != nil && contentNode.EndByte() > h.StartByte {
 				newConfig := h.InjectionCallback(languageName)
 				if newConfig != nil {
 					ranges := intersectRanges(layer.Ranges, []tree_sitter.Node{*contentNode}, includeChildren)
 					if len(ranges) > 0 {
-						newLayers, err := newIterLayers(h.Ctx, h.Source, h.LanguageName, h.Highlighter, h.InjectionCallback, *newConfig, layer.Depth+1, ranges)
+						newLayers, err := newIterLayers(h.Ctx, h.Source, h.LanguageName, h.Highlighter, h.ParseLayer, h.InjectionCallback, *newConfig, layer.Depth+1, ranges, h.StartByte, h.EndByte)
 						if err != nil {
 							return nil, err
 						}
@@ -156,12 +187,12 @@ main:
 		// If this capture is for tracking local variables, then process the
 		// local variable info.
 		var referenceHighlight *Highlight
-		var definitionHighlight *Highlight
+		var definition *localDef
 		for match.PatternIndex < layer.Config.HighlightsPatternIndex {
 			// If the node represents a local scope, push a new local scope onto
 			// the scope stack.
 			if layer.Config.LocalScopeCaptureIndex != nil && uint(capture.Index) == *layer.Config.LocalScopeCaptureIndex {
-				definitionHighlight = nil
+				definition = nil
 				scope := localScope{
 					Inherits:  true,
 					Range:     nextCaptureRange,
@@ -169,7 +200,7 @@ main:
 				}
 				for _, prop := range layer.Config.Query.PropertySettings(match.PatternIndex) {
 					if prop.Key == captureLocalScopeInherits {
-						scope.Inherits = *prop.Value == "true"
+						scope.Inherits = prop.Value == nil || *prop.Value == "true"
 					}
 				}
 				layer.ScopeStack = append(layer.ScopeStack, scope)
@@ -177,8 +208,7 @@ main:
 				// If the node represents a definition, add a new definition to the
 				// local scope at the top of the scope stack.
 				referenceHighlight = nil
-				definitionHighlight = nil
-				scope := layer.ScopeStack[len(layer.ScopeStack)-1]
+				scope := &layer.ScopeStack[len(layer.ScopeStack)-1]
 
 				var valueRange tree_sitter.Range
 				for _, matchCapture := range match.Captures {
@@ -187,33 +217,27 @@ main:
 					}
 				}
 
-				if len(h.Source) > int(nextCaptureRange.StartByte) && len(h.Source) > int(valueRange.EndByte) {
-					name := string(h.Source[nextCaptureRange.StartByte:nextCaptureRange.EndByte])
-
+				if nextCaptureRange.EndByte <= uint(len(h.Source)) {
 					scope.LocalDefs = append(scope.LocalDefs, localDef{
-						Name:      name,
-						Range:     nextCaptureRange,
-						Highlight: nil,
+						Name:       string(h.Source[nextCaptureRange.StartByte:nextCaptureRange.EndByte]),
+						ValueRange: valueRange,
+						Highlight:  nil,
 					})
-					definitionHighlight = scope.LocalDefs[len(scope.LocalDefs)-1].Highlight
+					definition = &scope.LocalDefs[len(scope.LocalDefs)-1]
 				}
-			} else if layer.Config.LocalRefCaptureIndex != nil && uint(capture.Index) == *layer.Config.LocalRefCaptureIndex && definitionHighlight == nil {
+			} else if layer.Config.LocalRefCaptureIndex != nil && uint(capture.Index) == *layer.Config.LocalRefCaptureIndex && definition == nil {
 				// If the node represents a reference, then try to find the corresponding
 				// definition in the scope stack.
-				definitionHighlight = nil
-				if len(h.Source) > int(nextCaptureRange.StartByte) && len(h.Source) > int(nextCaptureRange.EndByte) {
+				if nextCaptureRange.EndByte <= uint(len(h.Source)) {
 					name := string(h.Source[nextCaptureRange.StartByte:nextCaptureRange.EndByte])
+				scopes:
 					for _, scope := range slices.Backward(layer.ScopeStack) {
-						var highlight *Highlight
 						for _, def := range slices.Backward(scope.LocalDefs) {
-							if def.Name == name && nextCaptureRange.StartByte >= def.Range.EndByte {
-								highlight = def.Highlight
+							if def.Name == name && nextCaptureRange.StartByte >= def.ValueRange.EndByte {
+								referenceHighlight = def.Highlight
+								break scopes
 							}
 						}
-						if highlight != nil {
-							referenceHighlight = highlight
-							break
-						}
 						if !scope.Inherits {
 							break
 						}
@@ -263,7 +287,7 @@ main:
 				// If the current node was found to be a local variable, then ignore
 				// the following match if it's a highlighting pattern that is disabled
 				// for local variables.
-				if definitionHighlight != nil || referenceHighlight != nil && layer.Config.NonLocalVariablePatterns[followingMatch.PatternIndex] {
+				if (definition != nil || referenceHighlight != nil) && layer.Config.NonLocalVariablePatterns[followingMatch.PatternIndex] {
 					continue
 				}
 
@@ -279,8 +303,14 @@ main:
 
 		// If this node represents a local definition, then store the current
 		// highlight value on the local scope entry representing this node.
-		if definitionHighlight != nil {
-			definitionHighlight = currentHighlight
+		if definition != nil {
+			definition.Highlight = currentHighlight
+		}
+
+		// Captures before the highlighted range are only processed for their local variables.
+		if nextCaptureRange.EndByte <= h.StartByte && nextCaptureRange.StartByte < h.StartByte {
+			h.sortLayers()
+			continue main
 		}
 
 		// Emit a scope start event and push the node's end position to the stack.
@@ -304,6 +334,9 @@ main:
 	}
 }
 
+// sortLayers moves the first layer to its place after processing one of its captures.
+// The layers are kept in ascending order of their sort keys, so the first layer always has the next event.
+// Layers without a sort key have no captures left and are closed.
 func (h *iterator) sortLayers() {
 	for len(h.Layers) > 0 {
 		key := h.Layers[0].sortKey()
@@ -312,7 +345,7 @@ func (h *iterator) sortLayers() {
 			for i+1 < len(h.Layers) {
 				nextOffsetKey := h.Layers[i+1].sortKey()
 				if nextOffsetKey != nil {
-					if nextOffsetKey.GreaterThan(*key) {
+					if nextOffsetKey.LessThan(*key) {
 						i += 1
 						continue
 					}
@@ -326,10 +359,20 @@ func (h *iterator) sortLayers() {
 		}
 		layer := h.Layers[0]
 		h.Layers = h.Layers[1:]
-		h.Highlighter.pushCursor(layer.Cursor)
+		layer.close(h.Highlighter)
+	}
+}
+
+// close releases the trees and query cursors of all remaining layers.
+func (h *iterator) close() {
+	for _, layer := range h.Layers {
+		layer.close(h.Highlighter)
 	}
+	h.Layers = nil
 }
 
+// insertLayer inserts a new injection layer before the first layer with a greater sort key.
+// The first layer is skipped as it is the layer whose capture is currently processed.
 func (h *iterator) insertLayer(layer *iterLayer) {
 	key := layer.sortKey()
 	if key != nil {
@@ -337,19 +380,24 @@ func (h *iterator) insertLayer(layer *iterLayer) {
 		for i < len(h.Layers) {
 			keyI := h.Layers[i].sortKey()
 			if keyI != nil {
-				if keyI.LessThan(*key) {
+				if keyI.GreaterThan(*key) {
 					h.Layers = slices.Insert(h.Layers, i, layer)
 					return
 				}
 				i += 1
 			} else {
+				h.Layers[i].close(h.Highlighter)
 				h.Layers = slices.Delete(h.Layers, i, i+1)
 			}
 		}
 		h.Layers = append(h.Layers, layer)
+		return
 	}
+	layer.close(h.Highlighter)
 }
 
+// rotateLeft returns the slice rotated left by i elements. The result does not share memory with s,
+// so rotating a sub slice does not overwrite the elements after it.
 func rotateLeft[T any](s []T, i int) []T {
-	return append(s[i:], s[:i]...)
+	return append(slices.Clone(s[i:]), s[:i]...)
 }
@@ -2,7 +2,7 @@ package highlight
 
 import (
 	"context"
-	"fmt"
+	"errors"
 
 	"github.com/tree-sitter/go-tree-sitter"
 )
@@ -72,9 +72,9 @@ type _queryCapture struct {
 }
 
 type localDef struct {
-	Name      string
-	Range     tree_sitter.Range
-	Highlight *Highlight
+	Name       string
+	ValueRange tree_sitter.Range
+	Highlight  *Highlight
 }
 
 type localScope struct {
@@ -83,98 +83,82 @@ type localScope struct {
 	LocalDefs []localDef
 }
 
+// layerParser returns the syntax tree for a language layer with the given ranges.
+// If the ranges are invalid no tree and no error is returned.
+type layerParser func(ctx context.Context, config Configuration, depth uint, ranges []tree_sitter.Range) (*tree_sitter.Tree, error)
+
 func newIterLayers(
 	ctx context.Context,
 	source []byte,
 	parentName string,
 	highlighter *Highlighter,
+	parseLayer layerParser,
 	injectionCallback InjectionCallback,
 	config Configuration,
 	depth uint,
 	ranges []tree_sitter.Range,
+	startByte uint,
+	endByte uint,
 ) ([]*iterLayer, error) {
 	var result []*iterLayer
 	var queue []highlightQueueItem
 	for {
-		if err := highlighter.Parser.SetIncludedRanges(ranges); err == nil {
-			if err = highlighter.Parser.SetLanguage(config.Language); err != nil {
-				return nil, fmt.Errorf("error setting language: %w", err)
+		tree, err := parseLayer(ctx, config, depth, ranges)
+		if err != nil {
+			for _, layer := range result {
+				layer.close(highlighter)
 			}
-			tree := highlighter.Parser.ParseCtx(ctx, source, nil)
-
+			return nil, err
+		}
+		if tree != nil {
+			highlighter.live.trees++
 			cursor := highlighter.popCursor()
 
 			// Process combined injections.
-			if config.CombinedInjectionsQuery != nil {
-				injectionsByPatternIndex := make([]injectionItem, config.CombinedInjectionsQuery.PatternCount())
-
-				matches := cursor.Matches(config.CombinedInjectionsQuery, tree.RootNode(), source)
-				for {
-					match := matches.Next()
-					if match == nil {
-						break
-					}
-
-					languageName, contentNode, includeChildren := injectionForMatch(config, parentName, config.CombinedInjectionsQuery, *match, source)
-
-					if languageName == "" {
-						injectionsByPatternIndex[match.PatternIndex].languageName = languageName
-					}
-					if contentNode != nil {
-						injectionsByPatternIndex[match.PatternIndex].nodes = append(injectionsByPatternIndex[match.PatternIndex].nodes, *contentNode)
-					}
-					injectionsByPatternIndex[match.PatternIndex].includeChildren = includeChildren
-				}
-
-				for _, injection := range injectionsByPatternIndex {
-					if injection.languageName != "" && len(injection.nodes) > 0 {
-						nextConfig := injectionCallback(injection.languageName)
-						if nextConfig != nil {
-							nextRanges := intersectRanges(ranges, injection.nodes, injection.includeChildren)
-							if len(nextRanges) > 0 {
-								queue = append(queue, highlightQueueItem{
-									config: *nextConfig,
-									depth:  depth + 1,
-									ranges: nextRanges,
-								})
-							}
-						}
-					}
-				}
+			queue = append(queue, combinedInjections(cursor, tree, source, parentName, injectionCallback, config, depth, ranges)...)
+
+			// Only highlight the requested byte range, combined injections are processed for the whole layer above.
+			// Local definitions and scopes before the range are needed to highlight the references within it,
+			// so layers with locals are queried from the start and the captures before the range are skipped while iterating.
+			cursorStartByte := startByte
+			if config.LocalsPatternIndex < config.HighlightsPatternIndex {
+				cursorStartByte = 0
 			}
-
+			cursor.SetByteRange(cursorStartByte, endByte)
 			queryCaptures := newQueryCapturesIter(cursor.Captures(config.Query, tree.RootNode(), source))
-			if _, _, ok := queryCaptures.Peek(); !ok {
-				continue
-			}
-
-			result = append(result, &iterLayer{
-				Tree:              tree,
-				Cursor:            cursor,
-				Config:            config,
-				HighlightEndStack: nil,
-				ScopeStack: []localScope{
-					{
-						Inherits: false,
-						Range: tree_sitter.Range{
-							StartByte: 0,
-							StartPoint: tree_sitter.Point{
-								Row:    0,
-								Column: 0,
-							},
-							EndByte: ^uint(0),
-							EndPoint: tree_sitter.Point{
-								Row:    ^uint(0),
-								Column: ^uint(0),
+			if _, _, ok := queryCaptures.Peek(); ok {
+				result = append(result, &iterLayer{
+					Tree:              tree,
+					Cursor:            cursor,
+					Config:            config,
+					HighlightEndStack: nil,
+					ScopeStack: []localScope{
+						{
+							Inherits: false,
+							Range: tree_sitter.Range{
+								StartByte: 0,
+								StartPoint: tree_sitter.Point{
+									Row:    0,
+									Column: 0,
+								},
+								EndByte: ^uint(0),
+								EndPoint: tree_sitter.Point{
+									Row:    ^uint(0),
+									Column: ^uint(0),
+								},
 							},
+							LocalDefs: nil,
 						},
-						LocalDefs: nil,
 					},
-				},
-				Captures: queryCaptures,
-				Ranges:   ranges,
-				Depth:    depth,
-			})
+					Captures: queryCaptures,
+					Ranges:   ranges,
+					Depth:    depth,
+				})
+			} else {
+				highlighter.pushCursor(cursor)
+				tree.Close()
+				highlighter.live.trees--
+			}
 		}
 
 		if len(queue) == 0 {
@@ -182,7 +166,7 @@ func newIterLayers(
 		}
 
 		var next highlightQueueItem
-		next, queue = queue[0], append(queue, queue[1:]...)
+		next, queue = queue[0], queue[1:]
 
 		config = next.config
 		depth = next.depth
@@ -192,6 +176,82 @@ func newIterLayers(
 	return result, nil
 }
 
+// combinedInjections collects the combined injections of a layer. All nodes of a combined injection pattern are
+// merged into a single queue item.
+func combinedInjections(
+	cursor *tree_sitter.QueryCursor,
+	tree *tree_sitter.Tree,
+	source []byte,
+	parentName string,
+	injectionCallback InjectionCallback,
+	config Configuration,
+	depth uint,
+	ranges []tree_sitter.Range,
+) []highlightQueueItem {
+	if config.CombinedInjectionsQuery == nil {
+		return nil
+	}
+
+	injectionsByPatternIndex := make([]injectionItem, config.CombinedInjectionsQuery.PatternCount())
+
+	matches := cursor.Matches(config.CombinedInjectionsQuery, tree.RootNode(), source)
+	for {
+		match := matches.Next()
+		if match == nil {
+			break
+		}
+
+		languageName, contentNode, includeChildren := injectionForMatch(config, parentName, config.CombinedInjectionsQuery, *match, source)
+
+		if languageName != "" {
+			injectionsByPatternIndex[match.PatternIndex].languageName = languageName
+		}
+		if contentNode != nil {
+			injectionsByPatternIndex[match.PatternIndex].nodes = append(injectionsByPatternIndex[match.PatternIndex].nodes, *contentNode)
+		}
+		injectionsByPatternIndex[match.PatternIndex].includeChildren = includeChildren
+	}
+
+	var queue []highlightQueueItem
+	for _, injection := range injectionsByPatternIndex {
+		if injection.languageName != "" && len(injection.nodes) > 0 {
+			nextConfig := injectionCallback(injection.languageName)
+			if nextConfig != nil {
+				nextRanges := intersectRanges(ranges, injection.nodes, injection.includeChildren)
+				if len(nextRanges) > 0 {
+					queue = append(queue, highlightQueueItem{
+						config: *nextConfig,
+						depth:  depth + 1,
+						ranges: nextRanges,
+					})
+				}
+			}
+		}
+	}
+
+	return queue
+}
+
+// parse parses the source with the given parser. Unlike [tree_sitter.Parser.ParseCtx] this does not rely on the
+// parser's cancellation flag, instead the source is cut off as soon as the context is done.
+func parse(ctx context.Context, parser *tree_sitter.Parser, source []byte, oldTree *tree_sitter.Tree) (*tree_sitter.Tree, error) {
+	tree := parser.ParseWith(func(offset int, _ tree_sitter.Point) []byte {
+		if offset >= len(source) || ctx.Err() != nil {
+			return []byte{}
+		}
+		return source[offset:]
+	}, oldTree)
+	if err := ctx.Err(); err != nil {
+		tree.Close()
+		return nil, err
+	}
+	if tree == nil {
+		return nil, errors.New("error parsing source")
+	}
+
+	return tree, nil
+}
+
 type iterLayer struct {
 	Tree              *tree_sitter.Tree
 	Cursor            *tree_sitter.QueryCursor
@@ -203,6 +263,13 @@ type iterLayer struct {
 	Depth             uint
 }
 
+// close returns the query cursor of the layer to the highlighter and releases its tree.
+func (h *iterLayer) close(highlighter *Highlighter) {
+	highlighter.pushCursor(h.Cursor)
+	h.Tree.Close()
+	highlighter.live.trees--
+}
+
 func (h *iterLayer) sortKey() *sortKey {
 	depth := -int(h.Depth)
 
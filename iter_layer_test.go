@@ -1,7 +1,13 @@
 package highlight
 
 import (
+	"context"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tree-sitter/go-tree-sitter"
+	"github.com/tree-sitter/tree-sitter-go/bindings/go"
 )
 
 func Test_SortKeyCompare(t *testing.T) {
@@ -36,3 +42,52 @@ func Test_SortKeyCompare(t *testing.T) {
 		})
 	}
 }
+
+func Test_NewIterLayersCombinedInjections(t *testing.T) {
+	source := []byte("<ul>\n<% items.forEach(function(item) { %>\n<li><%= item %></li>\n<% }) %>\n</ul>\n")
+
+	cfg := loadTestConfiguration(t, "ejs")
+
+	highlighter := New()
+	layers, err := newIterLayers(context.Background(), source, "", highlighter, highlighter.parseLayer(source), testInjectionCallback(t), *cfg, 0, []tree_sitter.Range{documentRange}, 0, uint(len(source)))
+	require.NoError(t, err)
+	require.Len(t, layers, 3)
+
+	layerRanges := func(layer *iterLayer) []string {
+		var ranges []string
+		for _, r := range layer.Ranges {
+			ranges = append(ranges, string(source[r.StartByte:r.EndByte]))
+		}
+		return ranges
+	}
+
+	assert.Equal(t, "ejs", layers[0].Config.LanguageName)
+	assert.Equal(t, uint(0), layers[0].Depth)
+
+	// all content nodes are merged into a single html layer
+	assert.Equal(t, "html", layers[1].Config.LanguageName)
+	assert.Equal(t, uint(1), layers[1].Depth)
+	assert.Equal(t, []string{"<ul>\n", "\n<li>", "</li>\n", "\n</ul>\n"}, layerRanges(layers[1]))
+
+	// all code nodes are merged into a single javascript layer
+	assert.Equal(t, "javascript", layers[2].Config.LanguageName)
+	assert.Equal(t, uint(1), layers[2].Depth)
+	assert.Equal(t, []string{" items.forEach(function(item) { ", " item ", " }) "}, layerRanges(layers[2]))
+}
+
+func TestParse(t *testing.T) {
+	parser := tree_sitter.NewParser()
+	defer parser.Close()
+	require.NoError(t, parser.SetLanguage(tree_sitter.NewLanguage(tree_sitter_go.Language())))
+
+	tree, err := parse(context.Background(), parser, []byte("package main\n"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "source_file", tree.RootNode().Kind())
+	tree.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tree, err = parse(ctx, parser, []byte("package main\n"), nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, tree)
+}
@@ -45,3 +45,140 @@ func TestRotateLeft(t *testing.T) {
 		}
 	}
 }
+
+func TestRotateLeft_NoAliasing(t *testing.T) {
+	s := []string{"a", "b", "c", "d"}
+	actual := rotateLeft(s[:3], 1)
+
+	if !slices.Equal(actual, []string{"b", "c", "a"}) {
+		t.Errorf("expected [b c a], got %v", actual)
+	}
+	// the element after the sub slice must not be overwritten
+	if !slices.Equal(s, []string{"a", "b", "c", "d"}) {
+		t.Errorf("expected the original slice to be unchanged, got %v", s)
+	}
+}
+
+// endingLayer returns a layer without captures whose next event is the end of a highlight at the offset.
+func endingLayer(offset uint) *iterLayer {
+	return &iterLayer{
+		Captures:          &queryCapturesIter{peeked: &peekedQueryCapture{}},
+		HighlightEndStack: []uint{offset},
+	}
+}
+
+func layerOffsets(layers []*iterLayer) []uint {
+	var offsets []uint
+	for _, layer := range layers {
+		offsets = append(offsets, layer.sortKey().offset)
+	}
+	return offsets
+}
+
+func TestIterator_SortLayers(t *testing.T) {
+	tests := []struct {
+		name     string
+		offsets  []uint
+		expected []uint
+	}{
+		{
+			name:     "first layer is next",
+			offsets:  []uint{1, 2, 3},
+			expected: []uint{1, 2, 3},
+		},
+		{
+			name:     "first layer moves behind earlier layers",
+			offsets:  []uint{5, 2, 4, 8},
+			expected: []uint{2, 4, 5, 8},
+		},
+		{
+			name:     "first layer moves to the end",
+			offsets:  []uint{9, 2, 4},
+			expected: []uint{2, 4, 9},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &iterator{}
+			for _, offset := range tt.offsets {
+				h.Layers = append(h.Layers, endingLayer(offset))
+			}
+
+			h.sortLayers()
+			if offsets := layerOffsets(h.Layers); !slices.Equal(offsets, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, offsets)
+			}
+		})
+	}
+}
+
+func TestIterator_InsertLayer(t *testing.T) {
+	tests := []struct {
+		name     string
+		offset   uint
+		expected []uint
+	}{
+		{
+			name:     "insert in the middle",
+			offset:   6,
+			expected: []uint{2, 5, 6, 8},
+		},
+		{
+			name:     "insert at the end",
+			offset:   9,
+			expected: []uint{2, 5, 8, 9},
+		},
+		{
+			name:     "insert after the current layer",
+			offset:   1,
+			expected: []uint{2, 1, 5, 8},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &iterator{
+				Layers: []*iterLayer{endingLayer(2), endingLayer(5), endingLayer(8)},
+			}
+
+			h.insertLayer(endingLayer(tt.offset))
+			if offsets := layerOffsets(h.Layers); !slices.Equal(offsets, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, offsets)
+			}
+		})
+	}
+}
+
+func TestIterator_EmitEvents(t *testing.T) {
+	source := []byte("abc")
+	h := &iterator{Source: source, ByteOffset: 1, EndByte: 3}
+
+	// source before the offset comes first and the events are queued
+	event, err := h.emitEvents(2, EventCaptureEnd{}, EventLayerEnd{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source, ok := event.(EventSource); !ok || source.StartByte != 1 || source.EndByte != 2 {
+		t.Errorf("expected source from 1 to 2, got %#v", event)
+	}
+	if !slices.Equal(h.NextEvents, []Event{EventCaptureEnd{}, EventLayerEnd{}}) {
+		t.Errorf("expected the events to be queued, got %v", h.NextEvents)
+	}
+
+	// without source the first event is returned
+	h.NextEvents = nil
+	event, _ = h.emitEvents(2, EventCaptureEnd{}, EventLayerEnd{})
+	if event != (EventCaptureEnd{}) {
+		t.Errorf("expected capture end, got %#v", event)
+	}
+	if !slices.Equal(h.NextEvents, []Event{EventLayerEnd{}}) {
+		t.Errorf("expected the remaining event to be queued, got %v", h.NextEvents)
+	}
+
+	// without source and events the iteration ends
+	h.NextEvents = nil
+	if event, _ = h.emitEvents(2); event != nil {
+		t.Errorf("expected no event, got %#v", event)
+	}
+}
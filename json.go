@@ -0,0 +1,408 @@
+package highlight
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+
+	"github.com/tree-sitter/go-tree-sitter"
+)
+
+// JSONVersion is the version of the JSON schema written by [EncodeJSON], [EncodeNDJSON] and [EncodeSpansJSON].
+// It is increased when the schema changes in an incompatible way.
+const JSONVersion = 1
+
+// JSON event types.
+const (
+	jsonTypeHeader       = "header"
+	jsonTypeLayerStart   = "layer_start"
+	jsonTypeLayerEnd     = "layer_end"
+	jsonTypeCaptureStart = "capture_start"
+	jsonTypeCaptureEnd   = "capture_end"
+	jsonTypeSource       = "source"
+)
+
+// JSONOptions configures the JSON encoding of events and spans.
+type JSONOptions struct {
+	// CaptureNames are the names the configurations were configured with. They are included in the output and used to
+	// add the name of each highlight.
+	CaptureNames []string
+	// Source is the highlighted source code. If it is set, the text of each source event and span is included.
+	// The text is only meant for display, invalid UTF-8 is replaced by U+FFFD, the byte offsets always refer to the source code.
+	Source []byte
+}
+
+type jsonPoint struct {
+	Row    uint `json:"row"`
+	Column uint `json:"column"`
+}
+
+type jsonRange struct {
+	StartByte        uint      `json:"start_byte"`
+	EndByte          uint      `json:"end_byte"`
+	StartPoint       jsonPoint `json:"start_point"`
+	EndPoint         jsonPoint `json:"end_point"`
+	StartUTF16Column uint      `json:"start_utf16_column"`
+	EndUTF16Column   uint      `json:"end_utf16_column"`
+	Text             string    `json:"text,omitempty"`
+}
+
+func newJSONRange(e EventSource, options JSONOptions) jsonRange {
+	r := jsonRange{
+		StartByte:        e.StartByte,
+		EndByte:          e.EndByte,
+		StartPoint:       jsonPoint{Row: e.StartPoint.Row, Column: e.StartPoint.Column},
+		EndPoint:         jsonPoint{Row: e.EndPoint.Row, Column: e.EndPoint.Column},
+		StartUTF16Column: e.StartUTF16Column,
+		EndUTF16Column:   e.EndUTF16Column,
+	}
+	if options.Source != nil {
+		r.Text = string(options.Source[e.StartByte:e.EndByte])
+	}
+	return r
+}
+
+func (r jsonRange) event() EventSource {
+	return EventSource{
+		StartByte:        r.StartByte,
+		EndByte:          r.EndByte,
+		StartPoint:       tree_sitter.Point{Row: r.StartPoint.Row, Column: r.StartPoint.Column},
+		EndPoint:         tree_sitter.Point{Row: r.EndPoint.Row, Column: r.EndPoint.Column},
+		StartUTF16Column: r.StartUTF16Column,
+		EndUTF16Column:   r.EndUTF16Column,
+	}
+}
+
+type jsonHeader struct {
+	Type         string   `json:"type,omitempty"`
+	Version      int      `json:"version"`
+	CaptureNames []string `json:"capture_names"`
+}
+
+type jsonLayerStart struct {
+	Type     string `json:"type"`
+	Language string `json:"language"`
+}
+
+type jsonCaptureStart struct {
+	Type      string    `json:"type"`
+	Highlight Highlight `json:"highlight"`
+	Name      string    `json:"name,omitempty"`
+}
+
+type jsonSource struct {
+	Type string `json:"type"`
+	jsonRange
+}
+
+type jsonEventType struct {
+	Type string `json:"type"`
+}
+
+// jsonEvent has the fields of all event types and is used for decoding.
+type jsonEvent struct {
+	Type         string    `json:"type"`
+	Version      int       `json:"version"`
+	CaptureNames []string  `json:"capture_names"`
+	Language     string    `json:"language"`
+	Highlight    Highlight `json:"highlight"`
+	jsonRange
+}
+
+type jsonSpan struct {
+	jsonRange
+	Language   string      `json:"language"`
+	Highlights []Highlight `json:"highlights"`
+	Names      []string    `json:"names,omitempty"`
+}
+
+type jsonDocument struct {
+	Version      int               `json:"version"`
+	CaptureNames []string          `json:"capture_names"`
+	Events       []json.RawMessage `json:"events,omitempty"`
+	Spans        []jsonSpan        `json:"spans,omitempty"`
+}
+
+// marshalEvent returns the JSON representation of the event.
+func marshalEvent(event Event, options JSONOptions) ([]byte, error) {
+	var v any
+	switch e := event.(type) {
+	case EventLayerStart:
+		v = jsonLayerStart{Type: jsonTypeLayerStart, Language: e.LanguageName}
+	case EventLayerEnd:
+		v = jsonEventType{Type: jsonTypeLayerEnd}
+	case EventCaptureStart:
+		v = jsonCaptureStart{Type: jsonTypeCaptureStart, Highlight: e.Highlight, Name: options.captureName(e.Highlight)}
+	case EventCaptureEnd:
+		v = jsonEventType{Type: jsonTypeCaptureEnd}
+	case EventSource:
+		v = jsonSource{Type: jsonTypeSource, jsonRange: newJSONRange(e, options)}
+	default:
+		return nil, fmt.Errorf("unknown event type %T", event)
+	}
+	return json.Marshal(v)
+}
+
+// unmarshalEvent returns the event of the JSON representation.
+func unmarshalEvent(data []byte) (Event, error) {
+	var e jsonEvent
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+
+	switch e.Type {
+	case jsonTypeLayerStart:
+		return EventLayerStart{LanguageName: e.Language}, nil
+	case jsonTypeLayerEnd:
+		return EventLayerEnd{}, nil
+	case jsonTypeCaptureStart:
+		return EventCaptureStart{Highlight: e.Highlight}, nil
+	case jsonTypeCaptureEnd:
+		return EventCaptureEnd{}, nil
+	case jsonTypeSource:
+		return e.jsonRange.event(), nil
+	default:
+		return nil, fmt.Errorf("unknown event type %q", e.Type)
+	}
+}
+
+func (o JSONOptions) captureName(h Highlight) string {
+	if int(h) >= len(o.CaptureNames) {
+		return ""
+	}
+	return o.CaptureNames[h]
+}
+
+func (o JSONOptions) captureNames() []string {
+	if o.CaptureNames == nil {
+		return []string{}
+	}
+	return o.CaptureNames
+}
+
+func checkJSONVersion(version int) error {
+	if version != JSONVersion {
+		return fmt.Errorf("unsupported version %d, expected %d", version, JSONVersion)
+	}
+	return nil
+}
+
+// EncodeJSON writes the events as a JSON document of the form
+//
+//	{"version":1,"capture_names":["keyword"],"events":[{"type":"layer_start","language":"go"},...]}
+//
+// The events are objects with a type of layer_start, layer_end, capture_start, capture_end or source.
+// Capture start events have the highlight and its name, source events have the byte range, the start and end points,
+// the UTF-16 columns and optionally the text.
+func EncodeJSON(w io.Writer, events iter.Seq2[Event, error], options JSONOptions) error {
+	header, err := json.Marshal(jsonHeader{Version: JSONVersion, CaptureNames: options.captureNames()})
+	if err != nil {
+		return err
+	}
+
+	// write the events one by one instead of collecting them first
+	if _, err = w.Write(header[:len(header)-1]); err != nil {
+		return err
+	}
+	if _, err = io.WriteString(w, `,"events":[`); err != nil {
+		return err
+	}
+
+	first := true
+	for event, err := range events {
+		if err != nil {
+			return fmt.Errorf("error while encoding events: %w", err)
+		}
+
+		data, err := marshalEvent(event, options)
+		if err != nil {
+			return err
+		}
+		if !first {
+			if _, err = io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		first = false
+		if _, err = w.Write(data); err != nil {
+			return err
+		}
+	}
+
+	_, err = io.WriteString(w, "]}\n")
+	return err
+}
+
+// EncodeNDJSON writes the events as newline delimited JSON. The first line is a header with the version and the
+// capture names, e.g. {"type":"header","version":1,"capture_names":["keyword"]}, followed by one line per event
+// in the format of [EncodeJSON].
+func EncodeNDJSON(w io.Writer, events iter.Seq2[Event, error], options JSONOptions) error {
+	header, err := json.Marshal(jsonHeader{Type: jsonTypeHeader, Version: JSONVersion, CaptureNames: options.captureNames()})
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(append(header, '\n')); err != nil {
+		return err
+	}
+
+	for event, err := range events {
+		if err != nil {
+			return fmt.Errorf("error while encoding events: %w", err)
+		}
+
+		data, err := marshalEvent(event, options)
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// EncodeSpansJSON writes the spans as a JSON document of the form
+//
+//	{"version":1,"capture_names":["keyword"],"spans":[{"start_byte":0,"end_byte":7,...,"language":"go","highlights":[0],"names":["keyword"]},...]}
+//
+// Each span has the range of a source event, the language, the highlights from the outermost to the innermost and their names.
+func EncodeSpansJSON(w io.Writer, spans []Span, options JSONOptions) error {
+	doc := jsonDocument{
+		Version:      JSONVersion,
+		CaptureNames: options.captureNames(),
+		Spans:        make([]jsonSpan, 0, len(spans)),
+	}
+	for _, span := range spans {
+		s := jsonSpan{
+			jsonRange:  newJSONRange(span.source(), options),
+			Language:   span.LanguageName,
+			Highlights: span.Highlights,
+		}
+		if s.Highlights == nil {
+			s.Highlights = []Highlight{}
+		}
+		if options.CaptureNames != nil {
+			for _, h := range span.Highlights {
+				s.Names = append(s.Names, options.captureName(h))
+			}
+		}
+		doc.Spans = append(doc.Spans, s)
+	}
+
+	return json.NewEncoder(w).Encode(doc)
+}
+
+// DecodeJSON reads a JSON document written by [EncodeJSON] or [EncodeSpansJSON] and returns its events and capture names.
+// Spans are converted to events with [SpanEvents].
+func DecodeJSON(r io.Reader) ([]Event, []string, error) {
+	var doc jsonDocument
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("error decoding json: %w", err)
+	}
+	if err := checkJSONVersion(doc.Version); err != nil {
+		return nil, nil, fmt.Errorf("error decoding json: %w", err)
+	}
+
+	var events []Event
+	if doc.Spans != nil {
+		spans, err := decodeJSONSpans(doc.Spans)
+		if err != nil {
+			return nil, nil, err
+		}
+		for event := range SpanEvents(spans) {
+			events = append(events, event)
+		}
+		return events, doc.CaptureNames, nil
+	}
+
+	for i, data := range doc.Events {
+		event, err := unmarshalEvent(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error decoding event %d: %w", i, err)
+		}
+		events = append(events, event)
+	}
+
+	return events, doc.CaptureNames, nil
+}
+
+// DecodeSpansJSON reads a JSON document written by [EncodeSpansJSON] and returns its spans and capture names.
+func DecodeSpansJSON(r io.Reader) ([]Span, []string, error) {
+	var doc jsonDocument
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("error decoding json: %w", err)
+	}
+	if err := checkJSONVersion(doc.Version); err != nil {
+		return nil, nil, fmt.Errorf("error decoding json: %w", err)
+	}
+
+	spans, err := decodeJSONSpans(doc.Spans)
+	if err != nil {
+		return nil, nil, err
+	}
+	return spans, doc.CaptureNames, nil
+}
+
+func decodeJSONSpans(jsonSpans []jsonSpan) ([]Span, error) {
+	spans := make([]Span, 0, len(jsonSpans))
+	for _, s := range jsonSpans {
+		var highlights []Highlight
+		if len(s.Highlights) > 0 {
+			highlights = s.Highlights
+		}
+		spans = append(spans, newSpan(s.jsonRange.event(), s.Language, highlights))
+	}
+	return spans, nil
+}
+
+// DecodeNDJSON reads newline delimited JSON written by [EncodeNDJSON]. It reads the header and returns the capture names
+// and an iterator over the events, which reads the remaining lines.
+func DecodeNDJSON(r io.Reader) ([]string, iter.Seq2[Event, error], error) {
+	scanner := bufio.NewScanner(r)
+	// source events with text can be longer than the default limit
+	scanner.Buffer(nil, 64*1024*1024)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, nil, fmt.Errorf("error reading header: %w", err)
+		}
+		return nil, nil, errors.New("error reading header: missing header")
+	}
+
+	var header jsonHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return nil, nil, fmt.Errorf("error decoding header: %w", err)
+	}
+	if header.Type != jsonTypeHeader {
+		return nil, nil, fmt.Errorf("error decoding header: unexpected type %q", header.Type)
+	}
+	if err := checkJSONVersion(header.Version); err != nil {
+		return nil, nil, fmt.Errorf("error decoding header: %w", err)
+	}
+
+	return header.CaptureNames, func(yield func(Event, error) bool) {
+		line := 1
+		for scanner.Scan() {
+			line++
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+
+			event, err := unmarshalEvent(scanner.Bytes())
+			if err != nil {
+				yield(nil, fmt.Errorf("error decoding line %d: %w", line, err))
+				return
+			}
+			if !yield(event, nil) {
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			yield(nil, fmt.Errorf("error reading line %d: %w", line+1, err))
+		}
+	}, nil
+}
@@ -0,0 +1,162 @@
+package highlight
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tree-sitter/go-tree-sitter"
+)
+
+func TestEncodeJSON(t *testing.T) {
+	source := []byte("a ü\nb")
+	events := eventsOf(
+		EventLayerStart{LanguageName: "go"},
+		EventCaptureStart{Highlight: 0},
+		EventSource{StartByte: 0, EndByte: 1, EndPoint: tree_sitter.Point{Column: 1}, EndUTF16Column: 1},
+		EventCaptureEnd{},
+		EventSource{StartByte: 1, EndByte: 6, StartPoint: tree_sitter.Point{Column: 1}, EndPoint: tree_sitter.Point{Row: 1, Column: 1}, StartUTF16Column: 1, EndUTF16Column: 1},
+	)
+
+	tests := []struct {
+		name     string
+		options  JSONOptions
+		expected string
+	}{
+		{
+			name:     "without names and text",
+			expected: `{"version":1,"capture_names":[],"events":[{"type":"layer_start","language":"go"},{"type":"capture_start","highlight":0},{"type":"source","start_byte":0,"end_byte":1,"start_point":{"row":0,"column":0},"end_point":{"row":0,"column":1},"start_utf16_column":0,"end_utf16_column":1},{"type":"capture_end"},{"type":"source","start_byte":1,"end_byte":6,"start_point":{"row":0,"column":1},"end_point":{"row":1,"column":1},"start_utf16_column":1,"end_utf16_column":1}]}` + "\n",
+		},
+		{
+			name:     "with names and text",
+			options:  JSONOptions{CaptureNames: []string{"keyword"}, Source: source},
+			expected: `{"version":1,"capture_names":["keyword"],"events":[{"type":"layer_start","language":"go"},{"type":"capture_start","highlight":0,"name":"keyword"},{"type":"source","start_byte":0,"end_byte":1,"start_point":{"row":0,"column":0},"end_point":{"row":0,"column":1},"start_utf16_column":0,"end_utf16_column":1,"text":"a"},{"type":"capture_end"},{"type":"source","start_byte":1,"end_byte":6,"start_point":{"row":0,"column":1},"end_point":{"row":1,"column":1},"start_utf16_column":1,"end_utf16_column":1,"text":" ü\nb"}]}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := EncodeJSON(&buf, events, tt.options)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, buf.String())
+
+			decoded, captureNames, err := DecodeJSON(&buf)
+			require.NoError(t, err)
+			assert.Equal(t, collectEvents(t, events), decoded)
+			assert.Equal(t, tt.options.captureNames(), captureNames)
+		})
+	}
+}
+
+func TestEncodeNDJSON(t *testing.T) {
+	events := eventsOf(
+		EventLayerStart{LanguageName: "html"},
+		EventSource{StartByte: 0, EndByte: 1},
+		EventLayerEnd{},
+		EventLayerStart{LanguageName: "css"},
+		EventCaptureStart{Highlight: 1},
+		EventSource{StartByte: 1, EndByte: 2},
+		EventCaptureEnd{},
+	)
+
+	var buf bytes.Buffer
+	err := EncodeNDJSON(&buf, events, JSONOptions{CaptureNames: []string{"keyword", "string"}, Source: []byte("ab")})
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 8)
+	assert.Equal(t, `{"type":"header","version":1,"capture_names":["keyword","string"]}`, lines[0])
+	assert.Equal(t, `{"type":"layer_end"}`, lines[3])
+	assert.Equal(t, `{"type":"capture_start","highlight":1,"name":"string"}`, lines[5])
+
+	captureNames, decoded, err := DecodeNDJSON(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"keyword", "string"}, captureNames)
+	assert.Equal(t, collectEvents(t, events), collectEvents(t, decoded))
+}
+
+func TestDecodeNDJSON_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{
+			name:  "missing header",
+			input: "",
+			err:   "missing header",
+		},
+		{
+			name:  "not a header",
+			input: `{"type":"layer_end"}` + "\n",
+			err:   `unexpected type "layer_end"`,
+		},
+		{
+			name:  "unsupported version",
+			input: `{"type":"header","version":2,"capture_names":[]}` + "\n",
+			err:   "unsupported version 2",
+		},
+		{
+			name:  "unknown event",
+			input: `{"type":"header","version":1,"capture_names":[]}` + "\n" + `{"type":"foo"}` + "\n",
+			err:   `error decoding line 2: unknown event type "foo"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, events, err := DecodeNDJSON(strings.NewReader(tt.input))
+			if err == nil {
+				for _, err = range events {
+					if err != nil {
+						break
+					}
+				}
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestEncodeSpansJSON(t *testing.T) {
+	spans := []Span{
+		{StartByte: 0, EndByte: 1, LanguageName: "html"},
+		{StartByte: 1, EndByte: 2, LanguageName: "javascript", Highlights: []Highlight{0, 1}},
+	}
+
+	var buf bytes.Buffer
+	err := EncodeSpansJSON(&buf, spans, JSONOptions{CaptureNames: []string{"embedded", "keyword"}, Source: []byte("ab")})
+	require.NoError(t, err)
+	assert.Equal(t, `{"version":1,"capture_names":["embedded","keyword"],"spans":[{"start_byte":0,"end_byte":1,"start_point":{"row":0,"column":0},"end_point":{"row":0,"column":0},"start_utf16_column":0,"end_utf16_column":0,"text":"a","language":"html","highlights":[]},{"start_byte":1,"end_byte":2,"start_point":{"row":0,"column":0},"end_point":{"row":0,"column":0},"start_utf16_column":0,"end_utf16_column":0,"text":"b","language":"javascript","highlights":[0,1],"names":["embedded","keyword"]}]}`+"\n", buf.String())
+
+	decoded, captureNames, err := DecodeSpansJSON(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, spans, decoded)
+	assert.Equal(t, []string{"embedded", "keyword"}, captureNames)
+
+	events, _, err := DecodeJSON(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, collectEvents(t, SpanEvents(spans)), events)
+}
+
+func TestEncodeJSON_RoundTrip(t *testing.T) {
+	source := []byte("<div>\n<script>\nlet s = `a ${b}`; // ü\n</script>\n<style>\na { color: red; }\n</style>\n</div>\n")
+	cfg := loadTestConfiguration(t, "html")
+	options := JSONOptions{CaptureNames: StandardCaptureNames, Source: source}
+
+	var buf bytes.Buffer
+	err := EncodeNDJSON(&buf, New().Highlight(context.Background(), *cfg, source, testInjectionCallback(t)), options)
+	require.NoError(t, err)
+
+	captureNames, decoded, err := DecodeNDJSON(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, StandardCaptureNames, captureNames)
+
+	expected := collectEvents(t, New().Highlight(context.Background(), *cfg, source, testInjectionCallback(t)))
+	assert.Equal(t, expected, collectEvents(t, decoded))
+}
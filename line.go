@@ -0,0 +1,139 @@
+package highlight
+
+import (
+	"bytes"
+	"fmt"
+	"iter"
+	"slices"
+
+	"github.com/tree-sitter/go-tree-sitter"
+)
+
+// Line is a line of the source code with its highlighted tokens.
+type Line struct {
+	// Row is the zero-based row of the line.
+	Row uint
+	// StartByte and EndByte are the range of the line without the line break, which is either LF or CRLF.
+	StartByte uint
+	EndByte   uint
+	// LanguageName is the name of the language layer at the start of the line.
+	LanguageName string
+	// OpenHighlights are the highlights which are carried over from the previous lines, from the outermost to the innermost.
+	// An editor caching lines can stop re-highlighting after an edit once a line starts with the same open highlights
+	// and language as the cached line.
+	OpenHighlights []Highlight
+	// Tokens are the non-overlapping ranges of the line with their highlights, see [CollectSpans].
+	// They don't include the line break.
+	Tokens []Span
+}
+
+// Lines splits the events into lines. Each line has the tokens of the line and the highlights which are open at the
+// start of the line, so a line can be rendered on its own.
+// If the events are of [Highlighter.HighlightRange], the lines start and end with the range.
+// The first line has no open highlights, as the events don't tell whether a capture starts before or at the start of the range.
+// A line break at the end of the source code does not start another line.
+func Lines(events iter.Seq2[Event, error], source []byte) iter.Seq2[Line, error] {
+	return func(yield func(Line, error) bool) {
+		var (
+			line         *Line
+			highlights   []Highlight
+			languageName string
+			// the highlights and language when the last line break was consumed, before the captures of the next line start
+			openHighlights []Highlight
+			openLanguage   string
+			lineBreak      bool
+		)
+		for event, err := range events {
+			if err != nil {
+				yield(Line{}, fmt.Errorf("error while splitting lines: %w", err))
+				return
+			}
+
+			switch e := event.(type) {
+			case EventLayerStart:
+				languageName = e.LanguageName
+				if !lineBreak && openLanguage == "" {
+					// the first line starts in the first layer
+					openLanguage = e.LanguageName
+				}
+			case EventLayerEnd:
+				languageName = ""
+			case EventCaptureStart:
+				highlights = append(highlights, e.Highlight)
+			case EventCaptureEnd:
+				highlights = highlights[:len(highlights)-1]
+			case EventSource:
+				offset := e.StartByte
+				position := sourcePosition{Point: e.StartPoint, UTF16Column: e.StartUTF16Column}
+				for offset < e.EndByte {
+					if line == nil {
+						line = &Line{
+							Row:            position.Point.Row,
+							StartByte:      offset,
+							LanguageName:   openLanguage,
+							OpenHighlights: openHighlights,
+						}
+					}
+
+					end := e.EndByte
+					i := bytes.IndexByte(source[offset:e.EndByte], '\n')
+					if i != -1 {
+						end = offset + uint(i)
+					}
+
+					if end > offset {
+						endPosition := position.advance(source[offset:end])
+						line.Tokens = appendSpan(line.Tokens, EventSource{
+							StartByte:        offset,
+							EndByte:          end,
+							StartPoint:       position.Point,
+							EndPoint:         endPosition.Point,
+							StartUTF16Column: position.UTF16Column,
+							EndUTF16Column:   endPosition.UTF16Column,
+						}, languageName, highlights)
+						position = endPosition
+					}
+					line.EndByte = end
+					offset = end
+
+					if i != -1 {
+						trimCarriageReturn(line, source)
+						if !yield(*line, nil) {
+							return
+						}
+						line = nil
+						offset++
+						position = sourcePosition{Point: tree_sitter.Point{Row: position.Point.Row + 1}}
+
+						lineBreak = true
+						openHighlights = nil
+						if len(highlights) > 0 {
+							openHighlights = slices.Clone(highlights)
+						}
+						openLanguage = languageName
+					}
+				}
+			}
+		}
+
+		if line != nil {
+			yield(*line, nil)
+		}
+	}
+}
+
+// trimCarriageReturn removes the carriage return of a CRLF line break from the end of the line and its last token.
+func trimCarriageReturn(line *Line, source []byte) {
+	if line.EndByte == line.StartByte || source[line.EndByte-1] != '\r' {
+		return
+	}
+	line.EndByte--
+
+	last := &line.Tokens[len(line.Tokens)-1]
+	last.EndByte--
+	last.EndPoint.Column--
+	last.EndUTF16Column--
+	if last.StartByte == last.EndByte {
+		line.Tokens = line.Tokens[:len(line.Tokens)-1]
+	}
+}
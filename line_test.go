@@ -0,0 +1,169 @@
+package highlight
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tree-sitter/go-tree-sitter"
+)
+
+func TestLines(t *testing.T) {
+	source := []byte("a /*b\n\nc*/ d\n")
+	events := eventsOf(
+		EventLayerStart{LanguageName: "go"},
+		EventSource{StartByte: 0, EndByte: 2, EndPoint: tree_sitter.Point{Column: 2}, EndUTF16Column: 2},
+		EventCaptureStart{Highlight: 0},
+		EventSource{StartByte: 2, EndByte: 10, StartPoint: tree_sitter.Point{Column: 2}, StartUTF16Column: 2, EndPoint: tree_sitter.Point{Row: 2, Column: 3}, EndUTF16Column: 3},
+		EventCaptureEnd{},
+		EventSource{StartByte: 10, EndByte: 11, StartPoint: tree_sitter.Point{Row: 2, Column: 3}, StartUTF16Column: 3, EndPoint: tree_sitter.Point{Row: 2, Column: 4}, EndUTF16Column: 4},
+		EventCaptureStart{Highlight: 1},
+		EventSource{StartByte: 11, EndByte: 12, StartPoint: tree_sitter.Point{Row: 2, Column: 4}, StartUTF16Column: 4, EndPoint: tree_sitter.Point{Row: 2, Column: 5}, EndUTF16Column: 5},
+		EventCaptureEnd{},
+		EventSource{StartByte: 12, EndByte: 13, StartPoint: tree_sitter.Point{Row: 2, Column: 5}, StartUTF16Column: 5, EndPoint: tree_sitter.Point{Row: 3}},
+	)
+
+	var lines []Line
+	for line, err := range Lines(events, source) {
+		require.NoError(t, err)
+		lines = append(lines, line)
+	}
+
+	span := func(startByte uint, endByte uint, row uint, startColumn uint, endColumn uint, highlights ...Highlight) Span {
+		return Span{
+			StartByte:        startByte,
+			EndByte:          endByte,
+			StartPoint:       tree_sitter.Point{Row: row, Column: startColumn},
+			EndPoint:         tree_sitter.Point{Row: row, Column: endColumn},
+			StartUTF16Column: startColumn,
+			EndUTF16Column:   endColumn,
+			LanguageName:     "go",
+			Highlights:       highlights,
+		}
+	}
+	assert.Equal(t, []Line{
+		{
+			Row:          0,
+			StartByte:    0,
+			EndByte:      5,
+			LanguageName: "go",
+			Tokens:       []Span{span(0, 2, 0, 0, 2), span(2, 5, 0, 2, 5, 0)},
+		},
+		{
+			Row:            1,
+			StartByte:      6,
+			EndByte:        6,
+			LanguageName:   "go",
+			OpenHighlights: []Highlight{0},
+		},
+		{
+			Row:            2,
+			StartByte:      7,
+			EndByte:        12,
+			LanguageName:   "go",
+			OpenHighlights: []Highlight{0},
+			Tokens:         []Span{span(7, 10, 2, 0, 3, 0), span(10, 11, 2, 3, 4), span(11, 12, 2, 4, 5, 1)},
+		},
+	}, lines)
+}
+
+func TestLines_CaptureAtLineStart(t *testing.T) {
+	source := []byte("a\r\nb\r\n")
+	events := eventsOf(
+		EventLayerStart{LanguageName: "go"},
+		EventCaptureStart{Highlight: 0},
+		EventSource{StartByte: 0, EndByte: 1, EndPoint: tree_sitter.Point{Column: 1}, EndUTF16Column: 1},
+		EventCaptureEnd{},
+		EventSource{StartByte: 1, EndByte: 3, StartPoint: tree_sitter.Point{Column: 1}, StartUTF16Column: 1, EndPoint: tree_sitter.Point{Row: 1}},
+		EventCaptureStart{Highlight: 1},
+		EventSource{StartByte: 3, EndByte: 5, StartPoint: tree_sitter.Point{Row: 1}, EndPoint: tree_sitter.Point{Row: 1, Column: 2}, EndUTF16Column: 2},
+		EventCaptureEnd{},
+		EventSource{StartByte: 5, EndByte: 6, StartPoint: tree_sitter.Point{Row: 1, Column: 2}, StartUTF16Column: 2, EndPoint: tree_sitter.Point{Row: 2}},
+	)
+
+	var lines []Line
+	for line, err := range Lines(events, source) {
+		require.NoError(t, err)
+		lines = append(lines, line)
+	}
+
+	// captures starting at the start of a line are not open highlights and the carriage returns are not part of the lines
+	assert.Equal(t, []Line{
+		{
+			Row:          0,
+			StartByte:    0,
+			EndByte:      1,
+			LanguageName: "go",
+			Tokens: []Span{{
+				StartByte:      0,
+				EndByte:        1,
+				EndPoint:       tree_sitter.Point{Column: 1},
+				EndUTF16Column: 1,
+				LanguageName:   "go",
+				Highlights:     []Highlight{0},
+			}},
+		},
+		{
+			Row:          1,
+			StartByte:    3,
+			EndByte:      4,
+			LanguageName: "go",
+			Tokens: []Span{{
+				StartByte:      3,
+				EndByte:        4,
+				StartPoint:     tree_sitter.Point{Row: 1},
+				EndPoint:       tree_sitter.Point{Row: 1, Column: 1},
+				EndUTF16Column: 1,
+				LanguageName:   "go",
+				Highlights:     []Highlight{1},
+			}},
+		},
+	}, lines)
+}
+
+func TestLines_Highlight(t *testing.T) {
+	source := []byte("<p>ä</p>\n<script>\nlet s = `😀\n${b}`;\n</script>\n")
+	cfg := loadTestConfiguration(t, "html")
+
+	spans, err := CollectSpans(New().Highlight(context.Background(), *cfg, source, testInjectionCallback(t)))
+	require.NoError(t, err)
+
+	// every line starts with the highlights of the span covering the previous line break, and the tokens cover the line
+	var (
+		row            uint
+		carriedOver    int
+		openHighlights []Highlight
+		languageName   = "html"
+	)
+	for line, err := range Lines(New().Highlight(context.Background(), *cfg, source, testInjectionCallback(t)), source) {
+		require.NoError(t, err)
+		assert.Equal(t, row, line.Row)
+		assert.Equal(t, openHighlights, line.OpenHighlights)
+		assert.Equal(t, languageName, line.LanguageName)
+		if len(line.OpenHighlights) > 0 {
+			carriedOver++
+		}
+		row++
+
+		offset := line.StartByte
+		for _, token := range line.Tokens {
+			assert.Equal(t, offset, token.StartByte)
+			assert.Equal(t, line.Row, token.StartPoint.Row)
+			assert.Equal(t, positionAt(source, token.StartByte), sourcePosition{Point: token.StartPoint, UTF16Column: token.StartUTF16Column})
+			assert.Equal(t, positionAt(source, token.EndByte), sourcePosition{Point: token.EndPoint, UTF16Column: token.EndUTF16Column})
+			offset = token.EndByte
+		}
+		assert.Equal(t, line.EndByte, offset)
+
+		for _, span := range spans {
+			if span.StartByte <= line.EndByte && line.EndByte < span.EndByte {
+				openHighlights = span.Highlights
+				languageName = span.LanguageName
+			}
+		}
+	}
+	assert.Equal(t, uint(5), row)
+	// the template string continues on the next line
+	assert.Equal(t, 1, carriedOver)
+}
@@ -0,0 +1,263 @@
+package highlight
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/tree-sitter/go-tree-sitter"
+)
+
+const (
+	treeSitterJSON    = "tree-sitter.json"
+	queriesDir        = "queries"
+	highlightsQuery   = "highlights"
+	injectionsQuery   = "injections"
+	localsQuery       = "locals"
+	queryExtension    = ".scm"
+	inheritsDirective = "; inherits:"
+)
+
+// LoadLanguages loads the languages of a grammar directory. Use [os.DirFS] to load from the file system
+// or an [embed.FS] to embed the queries into the binary.
+//
+// If the directory contains a tree-sitter.json file, the grammars it lists are loaded with their file types, regexes
+// and query paths. Otherwise, every directory in queries is loaded as a language using queries/<language>/*.scm.
+//
+// Grammars cannot be loaded from files, so the grammar of each language has to be passed in grammars by the language name.
+// Languages without a grammar are skipped, their queries can still be inherited by other languages.
+// The configurations of the returned languages are created on first use by [Registry.Configuration].
+func LoadLanguages(fsys fs.FS, grammars map[string]*tree_sitter.Language) ([]Language, error) {
+	data, err := fs.ReadFile(fsys, treeSitterJSON)
+	if err == nil {
+		return loadTreeSitterJSON(fsys, data, grammars)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error reading %s: %w", treeSitterJSON, err)
+	}
+
+	entries, err := fs.ReadDir(fsys, queriesDir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading queries: %w", err)
+	}
+
+	var languages []Language
+	for _, entry := range entries {
+		grammar, ok := grammars[entry.Name()]
+		if !entry.IsDir() || !ok {
+			continue
+		}
+
+		languages = append(languages, Language{
+			Name: entry.Name(),
+			Load: func() (*Configuration, error) {
+				return LoadConfiguration(fsys, grammar, entry.Name())
+			},
+		})
+	}
+
+	return languages, nil
+}
+
+// LoadConfiguration creates a configuration from the queries in queries/<languageName>/*.scm of the file system.
+// Missing query files are treated as empty and `; inherits: lang1,lang2` directives are resolved, see [LoadQuery].
+func LoadConfiguration(fsys fs.FS, language *tree_sitter.Language, languageName string) (*Configuration, error) {
+	queries := make(map[string][]byte, 3)
+	for _, name := range []string{highlightsQuery, injectionsQuery, localsQuery} {
+		query, err := LoadQuery(fsys, languageName, name)
+		if err != nil {
+			return nil, err
+		}
+		queries[name] = query
+	}
+
+	return NewConfiguration(language, languageName, queries[highlightsQuery], queries[injectionsQuery], queries[localsQuery])
+}
+
+// LoadQuery reads the query queries/<languageName>/<queryName>.scm of the file system. A missing query file is treated as empty.
+//
+// If the first lines of the query contain an `; inherits: lang1,lang2` directive, the queries of the same name of the
+// inherited languages are prepended in order. Languages in parentheses like `(lang)` are optional and skipped if they
+// have no queries.
+func LoadQuery(fsys fs.FS, languageName string, queryName string) ([]byte, error) {
+	return loadQuery(fsys, path.Join(queriesDir, languageName, queryName+queryExtension), queryName, nil)
+}
+
+func loadQuery(fsys fs.FS, queryPath string, queryName string, visited []string) ([]byte, error) {
+	if slices.Contains(visited, queryPath) {
+		return nil, fmt.Errorf("error loading query %s: inheritance cycle %s", queryPath, strings.Join(append(visited, queryPath), " -> "))
+	}
+	visited = append(visited, queryPath)
+
+	data, err := fs.ReadFile(fsys, queryPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading query %s: %w", queryPath, err)
+	}
+
+	var query []byte
+	for _, inherited := range queryInherits(data) {
+		optional := strings.HasPrefix(inherited, "(") && strings.HasSuffix(inherited, ")")
+		inherited = strings.Trim(inherited, "()")
+
+		if _, err = fs.Stat(fsys, path.Join(queriesDir, inherited)); errors.Is(err, fs.ErrNotExist) {
+			if optional {
+				continue
+			}
+			return nil, fmt.Errorf("error loading query %s: inherited language %q not found", queryPath, inherited)
+		}
+
+		inheritedQuery, err := loadQuery(fsys, path.Join(queriesDir, inherited, queryName+queryExtension), queryName, visited)
+		if err != nil {
+			return nil, err
+		}
+		query = append(query, inheritedQuery...)
+		query = append(query, '\n')
+	}
+
+	return append(query, data...), nil
+}
+
+// queryInherits returns the languages of the `; inherits:` directives in the leading comments of the query.
+func queryInherits(query []byte) []string {
+	var inherits []string
+	scanner := bufio.NewScanner(bytes.NewReader(query))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, ";") {
+			break
+		}
+
+		languages, ok := strings.CutPrefix(line, inheritsDirective)
+		if !ok {
+			continue
+		}
+		for _, language := range strings.Split(languages, ",") {
+			if language = strings.TrimSpace(language); language != "" {
+				inherits = append(inherits, language)
+			}
+		}
+	}
+	return inherits
+}
+
+// treeSitterConfig is the part of a tree-sitter.json file which describes the grammars.
+type treeSitterConfig struct {
+	Grammars []treeSitterGrammar `json:"grammars"`
+}
+
+type treeSitterGrammar struct {
+	Name           string     `json:"name"`
+	Scope          string     `json:"scope"`
+	FileTypes      []string   `json:"file-types"`
+	Highlights     queryPaths `json:"highlights"`
+	Injections     queryPaths `json:"injections"`
+	Locals         queryPaths `json:"locals"`
+	InjectionRegex string     `json:"injection-regex"`
+	FirstLineRegex string     `json:"first-line-regex"`
+	ContentRegex   string     `json:"content-regex"`
+}
+
+// queryPaths is a list of query paths which is either a single string or an array of strings in JSON.
+type queryPaths []string
+
+func (p *queryPaths) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*p = queryPaths{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*p = multiple
+	return nil
+}
+
+func loadTreeSitterJSON(fsys fs.FS, data []byte, grammars map[string]*tree_sitter.Language) ([]Language, error) {
+	var config treeSitterConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", treeSitterJSON, err)
+	}
+
+	var languages []Language
+	for _, grammar := range config.Grammars {
+		language, ok := grammars[grammar.Name]
+		if !ok {
+			continue
+		}
+
+		var aliases []string
+		if grammar.Scope != "" {
+			aliases = append(aliases, grammar.Scope)
+		}
+
+		// tree-sitter matches file types against the whole file name and the extension
+		var globs []string
+		for _, fileType := range grammar.FileTypes {
+			globs = append(globs, fileType, "*."+fileType)
+		}
+
+		regexes := make([]*regexp.Regexp, 3)
+		for i, regex := range []string{grammar.InjectionRegex, grammar.FirstLineRegex, grammar.ContentRegex} {
+			if regex == "" {
+				continue
+			}
+			var err error
+			if regexes[i], err = regexp.Compile(regex); err != nil {
+				return nil, fmt.Errorf("error parsing regex of grammar %q: %w", grammar.Name, err)
+			}
+		}
+
+		languages = append(languages, Language{
+			Name:           grammar.Name,
+			Aliases:        aliases,
+			Globs:          globs,
+			InjectionRegex: regexes[0],
+			FirstLineRegex: regexes[1],
+			ContentRegex:   regexes[2],
+			Load: func() (*Configuration, error) {
+				return loadGrammarConfiguration(fsys, language, grammar)
+			},
+		})
+	}
+
+	return languages, nil
+}
+
+// loadGrammarConfiguration creates the configuration of a tree-sitter.json grammar.
+// Query paths are relative to the directory of the tree-sitter.json file and default to queries/<query>.scm.
+func loadGrammarConfiguration(fsys fs.FS, language *tree_sitter.Language, grammar treeSitterGrammar) (*Configuration, error) {
+	queries := make(map[string][]byte, 3)
+	for name, paths := range map[string]queryPaths{
+		highlightsQuery: grammar.Highlights,
+		injectionsQuery: grammar.Injections,
+		localsQuery:     grammar.Locals,
+	} {
+		if paths == nil {
+			paths = queryPaths{path.Join(queriesDir, name+queryExtension)}
+		}
+
+		for _, queryPath := range paths {
+			query, err := loadQuery(fsys, path.Clean(queryPath), name, nil)
+			if err != nil {
+				return nil, err
+			}
+			queries[name] = append(queries[name], query...)
+			queries[name] = append(queries[name], '\n')
+		}
+	}
+
+	return NewConfiguration(language, grammar.Name, queries[highlightsQuery], queries[injectionsQuery], queries[localsQuery])
+}
@@ -0,0 +1,151 @@
+package highlight
+
+import (
+	"context"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadLanguages(t *testing.T) {
+	languages, err := LoadLanguages(os.DirFS("testdata"), testLanguages)
+	require.NoError(t, err)
+
+	registry := NewRegistry()
+	var names []string
+	for _, language := range languages {
+		names = append(names, language.Name)
+		require.NoError(t, registry.Register(language))
+	}
+	assert.Equal(t, []string{"css", "ejs", "go", "html", "javascript"}, names)
+
+	registry.Configure(StandardCaptureNames)
+	defer registry.Close()
+
+	source := []byte("<p>hello</p>\n<script>\nlet a = 1;\n</script>\n<style>p { color: red; }</style>\n")
+	cfg, err := registry.Configuration("html")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	expected := collectEvents(t, New().Highlight(ctx, *loadTestConfiguration(t, "html"), source, testInjectionCallback(t)))
+	assert.Equal(t, expected, collectEvents(t, New().Highlight(ctx, *cfg, source, registry.InjectionCallback())))
+}
+
+func TestLoadQuery(t *testing.T) {
+	fsys := fstest.MapFS{
+		"queries/ecma/highlights.scm":       {Data: []byte("\"let\" @keyword\n")},
+		"queries/jsx/highlights.scm":        {Data: []byte("; inherits: ecma\n(jsx_element) @tag\n")},
+		"queries/javascript/highlights.scm": {Data: []byte("; inherits: jsx,(flow)\n\n(identifier) @variable\n")},
+		"queries/javascript/locals.scm":     {Data: []byte("; inherits: ecma\n")},
+		"queries/broken/highlights.scm":     {Data: []byte("; inherits: typescript\n")},
+		"queries/a/highlights.scm":          {Data: []byte("; inherits: b\n")},
+		"queries/b/highlights.scm":          {Data: []byte("; some comment\n; inherits: a\n")},
+	}
+
+	tests := []struct {
+		name      string
+		language  string
+		query     string
+		expected  string
+		expectErr bool
+	}{
+		{
+			name:     "nested inherits",
+			language: "javascript",
+			query:    "highlights",
+			expected: "\"let\" @keyword\n\n; inherits: ecma\n(jsx_element) @tag\n\n; inherits: jsx,(flow)\n\n(identifier) @variable\n",
+		},
+		{
+			name:     "inherited query missing",
+			language: "javascript",
+			query:    "locals",
+			expected: "\n; inherits: ecma\n",
+		},
+		{
+			name:     "query missing",
+			language: "javascript",
+			query:    "injections",
+			expected: "",
+		},
+		{
+			name:      "inherited language missing",
+			language:  "broken",
+			query:     "highlights",
+			expectErr: true,
+		},
+		{
+			name:      "inheritance cycle",
+			language:  "a",
+			query:     "highlights",
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := LoadQuery(fsys, tt.language, tt.query)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(query))
+		})
+	}
+}
+
+func TestLoadLanguages_TreeSitterJSON(t *testing.T) {
+	fsys := fstest.MapFS{
+		"tree-sitter.json": {Data: []byte(`{
+  "grammars": [
+    {
+      "name": "javascript",
+      "scope": "source.js",
+      "path": ".",
+      "file-types": ["js", "jsx"],
+      "highlights": ["queries/ecma.scm", "queries/highlights.scm"],
+      "injection-regex": "^(js|javascript)$",
+      "first-line-regex": "^#!.*\\bnode\\b"
+    },
+    {
+      "name": "python",
+      "file-types": ["py"]
+    }
+  ]
+}`)},
+		"queries/ecma.scm":       {Data: []byte("\"let\" @keyword\n")},
+		"queries/highlights.scm": {Data: []byte("(identifier) @variable\n")},
+		"queries/locals.scm":     {Data: []byte("(statement_block) @local.scope\n")},
+	}
+
+	languages, err := LoadLanguages(fsys, testLanguages)
+	require.NoError(t, err)
+	require.Len(t, languages, 1)
+
+	language := languages[0]
+	assert.Equal(t, "javascript", language.Name)
+	assert.Equal(t, []string{"source.js"}, language.Aliases)
+	assert.Equal(t, []string{"js", "*.js", "jsx", "*.jsx"}, language.Globs)
+	assert.Nil(t, language.ContentRegex)
+
+	registry := NewRegistry()
+	require.NoError(t, registry.Register(language))
+	defer registry.Close()
+
+	for _, path := range []string{"index.js", "component.jsx"} {
+		detected, ok := registry.Detect(path, nil)
+		assert.True(t, ok)
+		assert.Equal(t, "javascript", detected.Name)
+	}
+	detected, ok := registry.Detect("bin/run", []byte("#!/usr/bin/env node\n"))
+	assert.True(t, ok)
+	assert.Equal(t, "javascript", detected.Name)
+
+	cfg, err := registry.Configuration("js")
+	require.NoError(t, err)
+	assert.Equal(t, "javascript", cfg.LanguageName)
+	assert.ElementsMatch(t, []string{"keyword", "variable", "local.scope"}, cfg.Names())
+}
@@ -0,0 +1,101 @@
+package highlight
+
+import (
+	"context"
+	"iter"
+	"runtime"
+)
+
+// NewPool returns a new Pool which hands out at most size highlighters at the same time.
+// If size is less than 1, [runtime.GOMAXPROCS] is used as the size.
+// Highlighters are created lazily the first time they are needed.
+func NewPool(size int) *Pool {
+	if size < 1 {
+		size = runtime.GOMAXPROCS(0)
+	}
+
+	highlighters := make(chan *Highlighter, size)
+	for range size {
+		// nil is a placeholder for a highlighter which has not been created yet
+		highlighters <- nil
+	}
+
+	return &Pool{
+		highlighters: highlighters,
+	}
+}
+
+// Pool is a concurrency-safe pool of [Highlighter]s. It allows highlighting source code from multiple goroutines
+// while reusing the parsers and query cursors of the highlighters and limiting the number of concurrent highlights.
+type Pool struct {
+	highlighters chan *Highlighter
+}
+
+// Get borrows a highlighter from the pool. It blocks until a highlighter is available or the context is done.
+// The highlighter must be returned to the pool with [Pool.Put] once it is no longer used.
+func (p *Pool) Get(ctx context.Context) (*Highlighter, error) {
+	select {
+	case h := <-p.highlighters:
+		if h == nil {
+			h = New()
+		}
+		return h, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Put returns a highlighter borrowed with [Pool.Get] to the pool.
+// The highlighter must not be used after it has been returned.
+// Highlighters which don't fit into the pool, because they were not borrowed from it or returned twice, are closed.
+func (p *Pool) Put(h *Highlighter) {
+	select {
+	case p.highlighters <- h:
+	default:
+		// the highlighter was not borrowed from this pool, release it instead of leaking its parser and cursors
+		if h != nil {
+			h.Close()
+		}
+	}
+}
+
+// HighlightBytes highlights the source code like [Highlighter.Highlight] with a highlighter borrowed from the pool.
+// The highlighter is borrowed when the iteration starts and returned when it is done or stopped early.
+func (p *Pool) HighlightBytes(ctx context.Context, cfg Configuration, source []byte, injectionCallback InjectionCallback) iter.Seq2[Event, error] {
+	return func(yield func(Event, error) bool) {
+		h, err := p.Get(ctx)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer p.Put(h)
+
+		for event, err := range h.Highlight(ctx, cfg, source, injectionCallback) {
+			if !yield(event, err) {
+				return
+			}
+		}
+	}
+}
+
+// Close releases the resources of all highlighters which are currently not borrowed.
+// The pool can still be used afterwards, new highlighters are created as needed.
+func (p *Pool) Close() {
+	var closed int
+	for closed < cap(p.highlighters) {
+		select {
+		case h := <-p.highlighters:
+			if h != nil {
+				h.Close()
+			}
+			closed++
+			continue
+		default:
+		}
+		break
+	}
+
+	for range closed {
+		p.highlighters <- nil
+	}
+}
@@ -0,0 +1,168 @@
+package highlight
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPool_HighlightBytes(t *testing.T) {
+	sources := [][]byte{
+		[]byte("<p>hello</p>\n<script>\nlet a = `x ${b} y`;\n</script>\n<style>p { color: red; }</style>\n"),
+		[]byte("<ul>\n<% items.forEach(function(item) { %>\n<li><%= item %></li>\n<% }) %>\n</ul>\n"),
+	}
+	configs := map[string]*Configuration{
+		"css":        loadTestConfiguration(t, "css"),
+		"ejs":        loadTestConfiguration(t, "ejs"),
+		"html":       loadTestConfiguration(t, "html"),
+		"javascript": loadTestConfiguration(t, "javascript"),
+	}
+	injectionCallback := func(languageName string) *Configuration {
+		return configs[languageName]
+	}
+	rootConfigs := []*Configuration{configs["html"], configs["ejs"]}
+
+	ctx := context.Background()
+
+	expected := make([][]Event, len(sources))
+	for i, source := range sources {
+		expected[i] = collectEvents(t, New().Highlight(ctx, *rootConfigs[i], source, injectionCallback))
+	}
+
+	pool := NewPool(4)
+
+	var wg sync.WaitGroup
+	for i := range 64 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var events []Event
+			for event, err := range pool.HighlightBytes(ctx, *rootConfigs[i%2], sources[i%2], injectionCallback) {
+				if !assert.NoError(t, err) {
+					return
+				}
+				events = append(events, event)
+			}
+			assert.Equal(t, expected[i%2], events)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestPool_Get(t *testing.T) {
+	pool := NewPool(2)
+
+	ctx := context.Background()
+	h1, err := pool.Get(ctx)
+	require.NoError(t, err)
+	h2, err := pool.Get(ctx)
+	require.NoError(t, err)
+	assert.NotSame(t, h1, h2)
+
+	// the pool is exhausted
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = pool.Get(timeoutCtx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// returned highlighters are reused
+	pool.Put(h1)
+	h3, err := pool.Get(ctx)
+	require.NoError(t, err)
+	assert.Same(t, h1, h3)
+
+	pool.Put(h2)
+	pool.Put(h3)
+}
+
+func TestPool_HighlightBytesStopEarly(t *testing.T) {
+	source := []byte("package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n")
+	cfg := loadTestConfiguration(t, "go")
+
+	pool := NewPool(1)
+
+	ctx := context.Background()
+	for range pool.HighlightBytes(ctx, *cfg, source, nil) {
+		break
+	}
+
+	// the highlighter has been returned to the pool
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	h, err := pool.Get(timeoutCtx)
+	require.NoError(t, err)
+	pool.Put(h)
+
+	// an error is yielded if no highlighter is available in time
+	h, err = pool.Get(ctx)
+	require.NoError(t, err)
+	defer pool.Put(h)
+
+	timeoutCtx, cancel = context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	for _, err = range pool.HighlightBytes(timeoutCtx, *cfg, source, nil) {
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	}
+}
+
+func TestPool_Close(t *testing.T) {
+	source := []byte("package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n")
+	cfg := loadTestConfiguration(t, "go")
+
+	pool := NewPool(2)
+
+	ctx := context.Background()
+	expected := collectEvents(t, pool.HighlightBytes(ctx, *cfg, source, nil))
+
+	borrowed, err := pool.Get(ctx)
+	require.NoError(t, err)
+
+	pool.Close()
+
+	// the pool creates new highlighters after it has been closed
+	assert.Equal(t, expected, collectEvents(t, pool.HighlightBytes(ctx, *cfg, source, nil)))
+
+	// borrowed highlighters are not affected
+	assert.Equal(t, expected, collectEvents(t, borrowed.Highlight(ctx, *cfg, source, nil)))
+	pool.Put(borrowed)
+}
+
+func TestPool_PutForeign(t *testing.T) {
+	source := []byte("package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n")
+	cfg := loadTestConfiguration(t, "go")
+
+	pool := NewPool(1)
+	defer pool.Close()
+
+	// a highlighter which was not borrowed from the full pool is closed
+	h := New()
+	collectEvents(t, h.Highlight(context.Background(), *cfg, source, nil))
+	require.NotEmpty(t, h.cursors)
+
+	pool.Put(h)
+	assert.Nil(t, h.cursors)
+
+	// the pool still hands out its own highlighter
+	borrowed, err := pool.Get(context.Background())
+	require.NoError(t, err)
+	assert.NotSame(t, h, borrowed)
+	pool.Put(borrowed)
+}
+
+func TestPool_PutClosed(t *testing.T) {
+	pool := NewPool(1)
+	defer pool.Close()
+
+	// a closed highlighter which doesn't fit into the full pool is not closed again
+	h := New()
+	h.Close()
+	assert.Nil(t, h.Parser)
+
+	pool.Put(h)
+	assert.Nil(t, h.Parser)
+}
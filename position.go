@@ -0,0 +1,39 @@
+package highlight
+
+import (
+	"bytes"
+
+	"github.com/tree-sitter/go-tree-sitter"
+
+	"go.gopad.dev/go-tree-sitter-highlight/internal/textpos"
+)
+
+// sourcePosition is the position of a byte offset in the source code.
+type sourcePosition struct {
+	Point       tree_sitter.Point
+	UTF16Column uint
+}
+
+// positionAt returns the position of the byte offset in the source code.
+func positionAt(source []byte, offset uint) sourcePosition {
+	return sourcePosition{}.advance(source[:offset])
+}
+
+// pointAt returns the row and byte column of the offset in the source.
+func pointAt(source []byte, offset uint) tree_sitter.Point {
+	return positionAt(source, offset).Point
+}
+
+// advance returns the position after the text which starts at the position.
+func (p sourcePosition) advance(text []byte) sourcePosition {
+	if i := bytes.LastIndexByte(text, '\n'); i != -1 {
+		p.Point.Row += uint(bytes.Count(text, []byte("\n")))
+		p.Point.Column = 0
+		p.UTF16Column = 0
+		text = text[i+1:]
+	}
+
+	p.Point.Column += uint(len(text))
+	p.UTF16Column += textpos.UTF16Length(text)
+	return p
+}
@@ -0,0 +1,88 @@
+package highlight
+
+import (
+	"context"
+	"testing"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tree-sitter/go-tree-sitter"
+)
+
+func TestPositionAt(t *testing.T) {
+	source := []byte("ab\nä😀c\n\xffd")
+
+	tests := []struct {
+		name     string
+		offset   uint
+		expected sourcePosition
+	}{
+		{name: "start", offset: 0, expected: sourcePosition{}},
+		{name: "first line", offset: 2, expected: sourcePosition{Point: tree_sitter.Point{Row: 0, Column: 2}, UTF16Column: 2}},
+		{name: "line start", offset: 3, expected: sourcePosition{Point: tree_sitter.Point{Row: 1, Column: 0}, UTF16Column: 0}},
+		{name: "after two byte rune", offset: 5, expected: sourcePosition{Point: tree_sitter.Point{Row: 1, Column: 2}, UTF16Column: 1}},
+		{name: "after surrogate pair", offset: 9, expected: sourcePosition{Point: tree_sitter.Point{Row: 1, Column: 6}, UTF16Column: 3}},
+		{name: "after invalid byte", offset: 12, expected: sourcePosition{Point: tree_sitter.Point{Row: 2, Column: 1}, UTF16Column: 1}},
+		{name: "end", offset: uint(len(source)), expected: sourcePosition{Point: tree_sitter.Point{Row: 2, Column: 2}, UTF16Column: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, positionAt(source, tt.offset))
+
+			// advancing from any earlier rune gives the same position
+			for start := range tt.offset {
+				if !utf8.RuneStart(source[start]) {
+					continue
+				}
+				assert.Equal(t, tt.expected, positionAt(source, start).advance(source[start:tt.offset]), "from %d", start)
+			}
+		})
+	}
+}
+
+func TestHighlighter_HighlightPositions(t *testing.T) {
+	source := []byte("<p>ä😀</p>\n<script>\nlet s = \"😀\";\n</script>\n<style>\n.a { color: red; }\n</style>\n")
+	cfg := loadTestConfiguration(t, "html")
+
+	for _, r := range [][2]uint{{0, uint(len(source))}, {14, 40}} {
+		events := New().HighlightRange(context.Background(), *cfg, source, testInjectionCallback(t), r[0], r[1])
+
+		var sources int
+		for event, err := range events {
+			require.NoError(t, err)
+
+			e, ok := event.(EventSource)
+			if !ok {
+				continue
+			}
+			sources++
+
+			for _, p := range []struct {
+				offset      uint
+				point       tree_sitter.Point
+				utf16Column uint
+			}{
+				{e.StartByte, e.StartPoint, e.StartUTF16Column},
+				{e.EndByte, e.EndPoint, e.EndUTF16Column},
+			} {
+				// compute the expected position naively
+				var expected tree_sitter.Point
+				var lineStart uint
+				for i := range p.offset {
+					if source[i] == '\n' {
+						expected.Row++
+						lineStart = i + 1
+					}
+				}
+				expected.Column = p.offset - lineStart
+
+				assert.Equal(t, expected, p.point, "offset %d", p.offset)
+				assert.Equal(t, uint(len(utf16.Encode([]rune(string(source[lineStart:p.offset]))))), p.utf16Column, "offset %d", p.offset)
+			}
+		}
+		assert.NotZero(t, sources)
+	}
+}
@@ -0,0 +1,336 @@
+package highlight
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Language describes a language of a [Registry] and how to detect it.
+type Language struct {
+	// Name is the unique name of the language. It is also the name injections use to refer to the language.
+	Name string
+	// Aliases are alternative names of the language, e.g. "js" for "javascript".
+	Aliases []string
+	// Globs are file name patterns in the syntax of [path.Match], e.g. "*.go" or "Makefile".
+	// Patterns without a slash are matched against the base name of a path, other patterns against the end of the path.
+	Globs []string
+	// Interpreters are the interpreter names in a shebang line which identify the language, e.g. "node" or "python3".
+	Interpreters []string
+	// FirstLineRegex identifies the language by the first line of the content if no glob or interpreter matches.
+	FirstLineRegex *regexp.Regexp
+	// InjectionRegex matches injection language names which refer to the language in addition to its name and aliases.
+	InjectionRegex *regexp.Regexp
+	// ContentRegex decides between multiple languages whose globs match the same path.
+	// A language whose content regex does not match the content is not detected by its globs.
+	ContentRegex *regexp.Regexp
+	// Config is the highlight configuration of the language. If it is nil, Load is used to create it.
+	Config *Configuration
+	// Load creates the highlight configuration of the language the first time it is needed.
+	// This avoids compiling the queries of languages which are never highlighted.
+	Load func() (*Configuration, error)
+}
+
+// NewRegistry returns a new empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		names: make(map[string]int),
+	}
+}
+
+// Registry stores the languages an application supports. It looks up languages by name or alias, detects the language
+// of a file and provides an [InjectionCallback] for the registered languages.
+// Configurations are loaded on first use and cached. A Registry is safe for concurrent use.
+type Registry struct {
+	mu           sync.RWMutex
+	languages    []*registryLanguage
+	names        map[string]int
+	captureNames atomic.Pointer[[]string]
+}
+
+type registryLanguage struct {
+	Language
+
+	mu     sync.Mutex
+	loaded bool
+	config *Configuration
+	err    error
+}
+
+// Register adds a language to the registry. Names and aliases are case-insensitive and must be unique.
+func (r *Registry) Register(language Language) error {
+	if language.Name == "" {
+		return errors.New("language name must not be empty")
+	}
+	if language.Config == nil && language.Load == nil {
+		return fmt.Errorf("language %q has neither a configuration nor a loader", language.Name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := append([]string{language.Name}, language.Aliases...)
+	for _, name := range names {
+		if _, ok := r.names[strings.ToLower(name)]; ok {
+			return fmt.Errorf("language %q is already registered", name)
+		}
+	}
+
+	entry := &registryLanguage{
+		Language: language,
+	}
+	if language.Config != nil {
+		if captureNames := r.captureNames.Load(); captureNames != nil {
+			language.Config.Configure(*captureNames)
+		}
+		entry.loaded = true
+		entry.config = language.Config
+	}
+
+	for _, name := range names {
+		r.names[strings.ToLower(name)] = len(r.languages)
+	}
+	r.languages = append(r.languages, entry)
+
+	return nil
+}
+
+// Language returns the language with the given name or alias or whose InjectionRegex matches the name.
+// Use [Registry.Configuration] to get the configuration of a language which is loaded lazily.
+func (r *Registry) Language(name string) (Language, bool) {
+	language := r.lookup(name)
+	if language == nil {
+		return Language{}, false
+	}
+	return language.Language, true
+}
+
+// Languages returns all registered languages in the order they were registered.
+func (r *Registry) Languages() []Language {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	languages := make([]Language, 0, len(r.languages))
+	for _, language := range r.languages {
+		languages = append(languages, language.Language)
+	}
+	return languages
+}
+
+// Configuration returns the configuration of the language with the given name or alias.
+// If the language has no configuration yet, it is loaded and configured with the names passed to [Registry.Configure].
+// The result of the loader, including an error, is cached, so each language is loaded at most once.
+// Loaded configurations are owned by the registry and released by [Registry.Close], so they must not be closed by the caller.
+func (r *Registry) Configuration(name string) (*Configuration, error) {
+	language := r.lookup(name)
+	if language == nil {
+		return nil, fmt.Errorf("unknown language %q", name)
+	}
+
+	language.mu.Lock()
+	defer language.mu.Unlock()
+
+	if !language.loaded {
+		language.config, language.err = language.Load()
+		if language.err != nil {
+			language.err = fmt.Errorf("error loading language %q: %w", language.Name, language.err)
+		} else if captureNames := r.captureNames.Load(); captureNames != nil && language.config != nil {
+			language.config.Configure(*captureNames)
+		}
+		language.loaded = true
+	}
+
+	return language.config, language.err
+}
+
+// Configure sets the recognized highlight names of all loaded configurations and all configurations loaded later.
+// See [Configuration.Configure] for details. It must not be called while configurations of the registry are used to highlight.
+func (r *Registry) Configure(recognizedNames []string) {
+	r.captureNames.Store(&recognizedNames)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, language := range r.languages {
+		language.mu.Lock()
+		if language.config != nil {
+			language.config.Configure(recognizedNames)
+		}
+		language.mu.Unlock()
+	}
+}
+
+// Close releases the configurations which were created by a loader. Languages are loaded again when they are used afterwards.
+// The configurations returned by [Registry.Configuration] and the [InjectionCallback] before are released as well,
+// so Close must only be called after all highlighting with them is done, including iterators which are not exhausted yet.
+// Configurations which were registered with [Language.Config] are owned by the caller and not released.
+func (r *Registry) Close() {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, language := range r.languages {
+		language.mu.Lock()
+		if language.Load != nil && language.Config == nil && language.loaded {
+			if language.config != nil {
+				language.config.Close()
+			}
+			language.loaded = false
+			language.config = nil
+			language.err = nil
+		}
+		language.mu.Unlock()
+	}
+}
+
+// InjectionCallback returns an [InjectionCallback] which looks up injected languages by name or alias
+// and loads them on first use. Languages which fail to load are not injected.
+func (r *Registry) InjectionCallback() InjectionCallback {
+	return func(languageName string) *Configuration {
+		config, err := r.Configuration(languageName)
+		if err != nil {
+			return nil
+		}
+		return config
+	}
+}
+
+// lookup returns the language with the given name or alias or the first language whose InjectionRegex matches the name.
+func (r *Registry) lookup(name string) *registryLanguage {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if i, ok := r.names[strings.ToLower(name)]; ok {
+		return r.languages[i]
+	}
+
+	for _, language := range r.languages {
+		if language.InjectionRegex != nil && language.InjectionRegex.MatchString(name) {
+			return language
+		}
+	}
+	return nil
+}
+
+// Detect detects the language of a file from its path and content. The content may be nil if it is not known.
+//
+// The globs of all languages are matched against the path first. If multiple languages match, a language whose
+// ContentRegex matches the content is preferred, then the language with the longest matching glob and finally the
+// language which was registered first. If no glob matches, the interpreter of a shebang line and the FirstLineRegex
+// of each language are checked in this order.
+func (r *Registry) Detect(filePath string, content []byte) (Language, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	filePath = filepath.ToSlash(filePath)
+	firstLine, _, _ := bytes.Cut(content, []byte("\n"))
+	firstLine = bytes.TrimSuffix(firstLine, []byte("\r"))
+
+	best := -1
+	var bestGlobLen int
+	var bestContentMatch bool
+	for i, language := range r.languages {
+		globLen := matchGlobs(language.Globs, filePath)
+		if globLen == 0 {
+			continue
+		}
+
+		var contentMatch bool
+		if language.ContentRegex != nil {
+			if !language.ContentRegex.Match(content) {
+				continue
+			}
+			contentMatch = true
+		}
+
+		if best == -1 || (contentMatch && !bestContentMatch) || (contentMatch == bestContentMatch && globLen > bestGlobLen) {
+			best = i
+			bestGlobLen = globLen
+			bestContentMatch = contentMatch
+		}
+	}
+	if best != -1 {
+		return r.languages[best].Language, true
+	}
+
+	if interpreter := shebangInterpreter(firstLine); interpreter != "" {
+		for _, language := range r.languages {
+			for _, languageInterpreter := range language.Interpreters {
+				if languageInterpreter == interpreter {
+					return language.Language, true
+				}
+			}
+		}
+	}
+
+	for _, language := range r.languages {
+		if language.FirstLineRegex != nil && language.FirstLineRegex.Match(firstLine) {
+			return language.Language, true
+		}
+	}
+
+	return Language{}, false
+}
+
+// matchGlobs returns the length of the longest glob matching the slash separated path or 0 if no glob matches.
+func matchGlobs(globs []string, filePath string) int {
+	var longest int
+	for _, glob := range globs {
+		if len(glob) > longest && matchGlob(glob, filePath) {
+			longest = len(glob)
+		}
+	}
+	return longest
+}
+
+// matchGlob matches a glob against the base name of the path or, if the glob contains a slash, against the end of the path.
+func matchGlob(glob string, filePath string) bool {
+	if !strings.Contains(glob, "/") {
+		ok, _ := path.Match(glob, path.Base(filePath))
+		return ok
+	}
+
+	for {
+		if ok, _ := path.Match(glob, filePath); ok {
+			return true
+		}
+
+		i := strings.Index(filePath, "/")
+		if i == -1 {
+			return false
+		}
+		filePath = filePath[i+1:]
+	}
+}
+
+// shebangInterpreter returns the name of the interpreter of a shebang line like "#!/bin/sh" or "#!/usr/bin/env node".
+func shebangInterpreter(line []byte) string {
+	line, ok := bytes.CutPrefix(line, []byte("#!"))
+	if !ok {
+		return ""
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return ""
+	}
+
+	interpreter := path.Base(fields[0])
+	if interpreter != "env" {
+		return interpreter
+	}
+
+	// skip the options and variables of env
+	for _, field := range fields[1:] {
+		if strings.HasPrefix(field, "-") || strings.Contains(field, "=") {
+			continue
+		}
+		return path.Base(field)
+	}
+	return ""
+}
@@ -0,0 +1,257 @@
+package highlight
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRegistry(t *testing.T) *Registry {
+	t.Helper()
+
+	registry := NewRegistry()
+	for _, language := range []Language{
+		{
+			Name:  "go",
+			Globs: []string{"*.go"},
+		},
+		{
+			Name:         "javascript",
+			Aliases:      []string{"js", "JSX"},
+			Globs:        []string{"*.js", "*.mjs", "*.cjs"},
+			Interpreters: []string{"node"},
+		},
+		{
+			Name:           "html",
+			Globs:          []string{"*.html", "*.htm"},
+			FirstLineRegex: regexp.MustCompile(`(?i)^<!doctype html`),
+		},
+		{
+			Name:         "ejs",
+			Globs:        []string{"*.ejs", "*.html"},
+			ContentRegex: regexp.MustCompile(`<%`),
+		},
+		{
+			Name:  "css",
+			Globs: []string{"*.css", "styles/theme.*"},
+		},
+	} {
+		language.Config = loadTestConfiguration(t, language.Name)
+		require.NoError(t, registry.Register(language))
+	}
+
+	return registry
+}
+
+func TestRegistry_Register(t *testing.T) {
+	registry := newTestRegistry(t)
+
+	assert.Error(t, registry.Register(Language{}))
+	assert.Error(t, registry.Register(Language{Name: "python"}))
+	assert.Error(t, registry.Register(Language{Name: "Go", Config: &Configuration{}}))
+	assert.Error(t, registry.Register(Language{Name: "typescript", Aliases: []string{"jsx"}, Config: &Configuration{}}))
+
+	// a failed registration does not register any of the names
+	_, ok := registry.Language("typescript")
+	assert.False(t, ok)
+
+	var names []string
+	for _, language := range registry.Languages() {
+		names = append(names, language.Name)
+	}
+	assert.Equal(t, []string{"go", "javascript", "html", "ejs", "css"}, names)
+}
+
+func TestRegistry_Language(t *testing.T) {
+	registry := newTestRegistry(t)
+
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{name: "go", expected: "go"},
+		{name: "javascript", expected: "javascript"},
+		{name: "js", expected: "javascript"},
+		{name: "JavaScript", expected: "javascript"},
+		{name: "jsx", expected: "javascript"},
+		{name: "python", expected: ""},
+		{name: "", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			language, ok := registry.Language(tt.name)
+			assert.Equal(t, tt.expected != "", ok)
+			assert.Equal(t, tt.expected, language.Name)
+		})
+	}
+}
+
+func TestRegistry_Detect(t *testing.T) {
+	registry := newTestRegistry(t)
+
+	tests := []struct {
+		name     string
+		path     string
+		content  string
+		expected string
+	}{
+		{name: "extension", path: "main.go", expected: "go"},
+		{name: "extension in directory", path: "/src/app/index.mjs", expected: "javascript"},
+		{name: "unknown extension", path: "main.rs", expected: ""},
+		{name: "glob with directory", path: "web/styles/theme.scss", expected: "css"},
+		{name: "glob with directory mismatch", path: "web/theme.scss", expected: ""},
+		{name: "content regex", path: "index.html", content: "<ul><% items.forEach(item => { %>", expected: "ejs"},
+		{name: "content regex mismatch", path: "index.html", content: "<ul></ul>", expected: "html"},
+		{name: "shebang", path: "bin/run", content: "#!/usr/bin/node\nconsole.log(1)\n", expected: "javascript"},
+		{name: "shebang env", path: "bin/run", content: "#!/usr/bin/env -S node --no-warnings\n", expected: "javascript"},
+		{name: "shebang unknown", path: "bin/run", content: "#!/bin/sh\n", expected: ""},
+		{name: "glob before shebang", path: "main.go", content: "#!/usr/bin/env node\n", expected: "go"},
+		{name: "first line", path: "index", content: "<!DOCTYPE html>\r\n<html></html>", expected: "html"},
+		{name: "no content", path: "README", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			language, ok := registry.Detect(tt.path, []byte(tt.content))
+			assert.Equal(t, tt.expected != "", ok)
+			assert.Equal(t, tt.expected, language.Name)
+		})
+	}
+}
+
+func TestRegistry_InjectionCallback(t *testing.T) {
+	registry := newTestRegistry(t)
+	source := []byte("<p>hello</p>\n<script>\nlet a = 1;\n</script>\n<style>p { color: red; }</style>\n")
+
+	html, ok := registry.Language("html")
+	require.True(t, ok)
+
+	ctx := context.Background()
+	expected := collectEvents(t, New().Highlight(ctx, *html.Config, source, testInjectionCallback(t)))
+	assert.Equal(t, expected, collectEvents(t, New().Highlight(ctx, *html.Config, source, registry.InjectionCallback())))
+
+	injectionCallback := registry.InjectionCallback()
+	assert.Same(t, html.Config, injectionCallback("HTML"))
+	assert.Nil(t, injectionCallback("python"))
+}
+
+// countingLoader returns a loader for the test configuration of the language which counts how often it is called.
+func countingLoader(t *testing.T, languageName string, calls *atomic.Int32) func() (*Configuration, error) {
+	return func() (*Configuration, error) {
+		calls.Add(1)
+		return loadTestConfiguration(t, languageName), nil
+	}
+}
+
+func TestRegistry_Configuration(t *testing.T) {
+	var goCalls, errorCalls atomic.Int32
+	registry := NewRegistry()
+	require.NoError(t, registry.Register(Language{Name: "go", Aliases: []string{"golang"}, Load: countingLoader(t, "go", &goCalls)}))
+	require.NoError(t, registry.Register(Language{Name: "broken", Load: func() (*Configuration, error) {
+		errorCalls.Add(1)
+		return nil, errors.New("invalid query")
+	}}))
+	defer registry.Close()
+
+	// nothing is loaded on registration
+	assert.Equal(t, int32(0), goCalls.Load())
+
+	configs := make([]*Configuration, 32)
+	var wg sync.WaitGroup
+	for i := range configs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			name := "go"
+			if i%2 == 1 {
+				name = "golang"
+			}
+			cfg, err := registry.Configuration(name)
+			assert.NoError(t, err)
+			configs[i] = cfg
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), goCalls.Load())
+	require.NotNil(t, configs[0])
+	for _, cfg := range configs {
+		assert.Same(t, configs[0], cfg)
+	}
+
+	for range 2 {
+		_, err := registry.Configuration("broken")
+		assert.ErrorContains(t, err, "invalid query")
+	}
+	assert.Equal(t, int32(1), errorCalls.Load())
+
+	_, err := registry.Configuration("python")
+	assert.Error(t, err)
+
+	// closed configurations are loaded again
+	registry.Close()
+	cfg, err := registry.Configuration("go")
+	require.NoError(t, err)
+	assert.NotSame(t, configs[0], cfg)
+	assert.Equal(t, int32(2), goCalls.Load())
+}
+
+func TestRegistry_InjectionCallbackLoadsLazily(t *testing.T) {
+	var htmlCalls, javascriptCalls, cssCalls atomic.Int32
+	registry := NewRegistry()
+	require.NoError(t, registry.Register(Language{Name: "html", Load: countingLoader(t, "html", &htmlCalls)}))
+	require.NoError(t, registry.Register(Language{Name: "javascript", Aliases: []string{"js"}, Load: countingLoader(t, "javascript", &javascriptCalls)}))
+	require.NoError(t, registry.Register(Language{Name: "css", Load: countingLoader(t, "css", &cssCalls)}))
+	defer registry.Close()
+
+	source := []byte("<p>hello</p>\n<script>\nlet a = 1;\n</script>\n")
+
+	cfg, err := registry.Configuration("html")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	expected := collectEvents(t, New().Highlight(ctx, *cfg, source, testInjectionCallback(t)))
+	for range 2 {
+		assert.Equal(t, expected, collectEvents(t, New().Highlight(ctx, *cfg, source, registry.InjectionCallback())))
+	}
+
+	assert.Equal(t, int32(1), htmlCalls.Load())
+	assert.Equal(t, int32(1), javascriptCalls.Load())
+	assert.Equal(t, int32(0), cssCalls.Load())
+}
+
+func TestRegistry_Configure(t *testing.T) {
+	registry := NewRegistry()
+	require.NoError(t, registry.Register(Language{Name: "go", Load: func() (*Configuration, error) {
+		return loadTestConfiguration(t, "go"), nil
+	}}))
+	defer registry.Close()
+
+	highlightOf := func(cfg *Configuration, captureName string) *Highlight {
+		i := slices.Index(cfg.Names(), captureName)
+		require.NotEqual(t, -1, i)
+		return cfg.HighlightIndices[i]
+	}
+
+	// configurations loaded after Configure use the names
+	registry.Configure([]string{"keyword"})
+	cfg, err := registry.Configuration("go")
+	require.NoError(t, err)
+	assert.Equal(t, new(Highlight), highlightOf(cfg, "keyword"))
+	assert.Nil(t, highlightOf(cfg, "string"))
+
+	// loaded configurations are configured again
+	registry.Configure([]string{"string", "keyword"})
+	keyword := Highlight(1)
+	assert.Equal(t, &keyword, highlightOf(cfg, "keyword"))
+	assert.Equal(t, new(Highlight), highlightOf(cfg, "string"))
+}
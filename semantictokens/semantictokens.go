@@ -0,0 +1,301 @@
+// Package semantictokens encodes highlight events as LSP semantic tokens.
+//
+// A [Legend] maps the capture names the configurations were configured with to semantic token types and modifiers.
+// [Encode] turns the events of [highlight.Highlighter.Highlight] or [highlight.Highlighter.HighlightRange] into the
+// relative encoded integers of the textDocument/semanticTokens/full and textDocument/semanticTokens/range responses,
+// and [Delta] computes the edits of a textDocument/semanticTokens/full/delta response.
+// Positions are encoded in UTF-16 code units, the default position encoding of LSP.
+package semantictokens
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"iter"
+	"slices"
+	"strings"
+
+	"go.gopad.dev/go-tree-sitter-highlight"
+	"go.gopad.dev/go-tree-sitter-highlight/internal/textpos"
+)
+
+// Mapping maps capture names to semantic token types and modifiers.
+type Mapping struct {
+	// Types maps capture names to token types. A capture name uses the type of its longest dot-separated prefix in
+	// Types, e.g. "function.method.call" uses the type of "function.method" or "function".
+	// Capture names mapped to an empty type are not encoded.
+	// Capture names without a mapped prefix use their first segment as a custom token type.
+	Types map[string]string
+	// Modifiers maps the dot-separated segments of capture names to token modifiers,
+	// e.g. "builtin" of "function.builtin" to "defaultLibrary".
+	Modifiers map[string]string
+}
+
+// DefaultMapping maps the [highlight.StandardCaptureNames] to the standard token types and modifiers of LSP.
+var DefaultMapping = Mapping{
+	Types: map[string]string{
+		"attribute":          "decorator",
+		"boolean":            "keyword",
+		"carriage-return":    "",
+		"comment":            "comment",
+		"constant":           "variable",
+		"constructor":        "class",
+		"embedded":           "",
+		"error":              "",
+		"escape":             "string",
+		"function":           "function",
+		"function.macro":     "macro",
+		"function.method":    "method",
+		"keyword":            "keyword",
+		"module":             "namespace",
+		"number":             "number",
+		"operator":           "operator",
+		"property":           "property",
+		"punctuation":        "",
+		"string":             "string",
+		"string.regexp":      "regexp",
+		"type":               "type",
+		"type.parameter":     "typeParameter",
+		"variable":           "variable",
+		"variable.member":    "property",
+		"variable.parameter": "parameter",
+	},
+	Modifiers: map[string]string{
+		"abstract":      "abstract",
+		"async":         "async",
+		"builtin":       "defaultLibrary",
+		"constant":      "readonly",
+		"declaration":   "declaration",
+		"definition":    "definition",
+		"deprecated":    "deprecated",
+		"documentation": "documentation",
+		"readonly":      "readonly",
+		"static":        "static",
+	},
+}
+
+// MaxTokenModifiers is the maximum number of token modifiers of a [Legend], the number of bits of the modifiers bitmask.
+const MaxTokenModifiers = 32
+
+// token is the encoded type and modifiers of a capture name.
+type token struct {
+	tokenType uint32
+	modifiers uint32
+}
+
+// Legend is the legend of the semantic tokens. It is sent to the client as the legend of the semanticTokensProvider
+// server capability and maps the highlights to the indices of its token types and modifiers.
+type Legend struct {
+	TokenTypes     []string `json:"tokenTypes"`
+	TokenModifiers []string `json:"tokenModifiers"`
+	// tokens are the tokens of the highlights, nil for highlights which are not encoded
+	tokens []*token
+}
+
+// NewLegend returns the legend for the capture names the configurations were configured with,
+// see [highlight.Configuration.Configure]. The token types and modifiers are in the order they are first used by the capture names.
+// The token modifiers are encoded as a bitmask of 32 bits, so it returns an error if the capture names use more than
+// [MaxTokenModifiers] modifiers.
+func NewLegend(captureNames []string, mapping Mapping) (*Legend, error) {
+	legend := &Legend{
+		tokens: make([]*token, len(captureNames)),
+	}
+
+	for i, name := range captureNames {
+		tokenType, ok := mapping.tokenType(name)
+		if !ok {
+			continue
+		}
+
+		t := &token{
+			tokenType: uint32(legend.index(&legend.TokenTypes, tokenType)),
+		}
+		for _, segment := range strings.Split(name, ".") {
+			if modifier, ok := mapping.Modifiers[segment]; ok {
+				index := legend.index(&legend.TokenModifiers, modifier)
+				if index >= MaxTokenModifiers {
+					return nil, fmt.Errorf("too many token modifiers: %q of %q exceeds the maximum of %d", modifier, name, MaxTokenModifiers)
+				}
+				t.modifiers |= 1 << index
+			}
+		}
+		legend.tokens[i] = t
+	}
+
+	return legend, nil
+}
+
+// index returns the index of the name in the names and appends it if it's missing.
+func (l *Legend) index(names *[]string, name string) int {
+	if i := slices.Index(*names, name); i != -1 {
+		return i
+	}
+	*names = append(*names, name)
+	return len(*names) - 1
+}
+
+func (l *Legend) token(h highlight.Highlight) *token {
+	if int(h) >= len(l.tokens) {
+		return nil
+	}
+	return l.tokens[h]
+}
+
+// tokenType returns the token type of the capture name and whether it is encoded.
+func (m Mapping) tokenType(captureName string) (string, bool) {
+	name := captureName
+	for {
+		if tokenType, ok := m.Types[name]; ok {
+			return tokenType, tokenType != ""
+		}
+
+		lastDot := strings.LastIndex(name, ".")
+		if lastDot == -1 {
+			first, _, _ := strings.Cut(captureName, ".")
+			return first, true
+		}
+		name = name[:lastDot]
+	}
+}
+
+// Encode encodes the highlight events as semantic tokens using the legend. Each token is encoded as five integers:
+// the line relative to the previous token, the start character relative to the previous token on the same line,
+// the length, the token type and the token modifiers.
+//
+// Text is encoded with the innermost capture which has a token type. Tokens are split at line breaks,
+// so clients don't need multiline token support. Adjacent text with the same token is merged into one token.
+func Encode(events iter.Seq2[highlight.Event, error], source []byte, legend *Legend) ([]uint32, error) {
+	e := &encoder{}
+
+	var stack []*token
+	current := func() *token {
+		for i := len(stack) - 1; i >= 0; i-- {
+			if stack[i] != nil {
+				return stack[i]
+			}
+		}
+		return nil
+	}
+	for event, err := range events {
+		if err != nil {
+			return nil, fmt.Errorf("error while encoding semantic tokens: %w", err)
+		}
+
+		switch ev := event.(type) {
+		case highlight.EventCaptureStart:
+			stack = append(stack, legend.token(ev.Highlight))
+		case highlight.EventCaptureEnd:
+			stack = stack[:len(stack)-1]
+		case highlight.EventSource:
+			t := current()
+			if t == nil {
+				continue
+			}
+
+			line := uint32(ev.StartPoint.Row)
+			character := uint32(ev.StartUTF16Column)
+			text := source[ev.StartByte:ev.EndByte]
+			for {
+				segment, rest, found := bytes.Cut(text, []byte("\n"))
+				if found {
+					// the carriage return of a CRLF line break is not part of the token
+					segment = bytes.TrimSuffix(segment, []byte("\r"))
+				}
+				e.add(line, character, uint32(textpos.UTF16Length(segment)), t)
+				if !found {
+					break
+				}
+				text = rest
+				line++
+				character = 0
+			}
+		}
+	}
+
+	return e.data, nil
+}
+
+// encoder relative encodes the tokens and merges adjacent tokens.
+type encoder struct {
+	data []uint32
+	// the absolute position, length and token of the last token
+	line      uint32
+	character uint32
+	length    uint32
+	token     *token
+}
+
+func (e *encoder) add(line uint32, character uint32, length uint32, t *token) {
+	if length == 0 {
+		return
+	}
+
+	// extend the previous token if the text continues it
+	if len(e.data) > 0 && line == e.line && character == e.character+e.length && *t == *e.token {
+		e.length += length
+		e.data[len(e.data)-3] = e.length
+		return
+	}
+
+	deltaLine := line - e.line
+	deltaCharacter := character
+	if deltaLine == 0 {
+		deltaCharacter = character - e.character
+	}
+	e.data = append(e.data, deltaLine, deltaCharacter, length, t.tokenType, t.modifiers)
+	e.line, e.character, e.length, e.token = line, character, length, t
+}
+
+// Edit is a semantic tokens edit of a textDocument/semanticTokens/full/delta response.
+type Edit struct {
+	// Start is the offset in the previous data.
+	Start uint32 `json:"start"`
+	// DeleteCount is the number of integers to delete.
+	DeleteCount uint32 `json:"deleteCount"`
+	// Data are the integers to insert.
+	Data []uint32 `json:"data,omitempty"`
+}
+
+// Delta returns the edits which turn the previous semantic tokens into the current ones.
+// It returns a single edit replacing the tokens between the common leading and trailing tokens, or no edits if the
+// tokens are equal.
+func Delta(previous []uint32, current []uint32) []Edit {
+	const tokenSize = 5
+
+	prefix := 0
+	for prefix+tokenSize <= min(len(previous), len(current)) && slices.Equal(previous[prefix:prefix+tokenSize], current[prefix:prefix+tokenSize]) {
+		prefix += tokenSize
+	}
+
+	suffix := 0
+	for suffix+tokenSize <= min(len(previous), len(current))-prefix &&
+		slices.Equal(previous[len(previous)-suffix-tokenSize:len(previous)-suffix], current[len(current)-suffix-tokenSize:len(current)-suffix]) {
+		suffix += tokenSize
+	}
+
+	if prefix == len(previous) && prefix == len(current) {
+		return nil
+	}
+
+	return []Edit{
+		{
+			Start:       uint32(prefix),
+			DeleteCount: uint32(len(previous) - prefix - suffix),
+			Data:        slices.Clone(current[prefix : len(current)-suffix]),
+		},
+	}
+}
+
+// ApplyEdits applies the edits of a delta to the previous semantic tokens, like a client does.
+func ApplyEdits(previous []uint32, edits []Edit) []uint32 {
+	data := slices.Clone(previous)
+	// apply the edits from the back so the offsets of the previous data stay valid
+	sorted := slices.Clone(edits)
+	slices.SortFunc(sorted, func(a, b Edit) int {
+		return cmp.Compare(b.Start, a.Start)
+	})
+	for _, edit := range sorted {
+		data = slices.Replace(data, int(edit.Start), int(edit.Start+edit.DeleteCount), edit.Data...)
+	}
+	return data
+}
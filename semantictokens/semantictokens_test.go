@@ -0,0 +1,269 @@
+package semantictokens
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tree-sitter/go-tree-sitter"
+	"github.com/tree-sitter/tree-sitter-go/bindings/go"
+
+	"go.gopad.dev/go-tree-sitter-highlight"
+)
+
+// decodedToken is a semantic token with an absolute position.
+type decodedToken struct {
+	line      uint32
+	character uint32
+	length    uint32
+	tokenType string
+	modifiers []string
+}
+
+func decode(legend *Legend, data []uint32) []decodedToken {
+	var tokens []decodedToken
+	var line, character uint32
+	for i := 0; i+5 <= len(data); i += 5 {
+		if data[i] > 0 {
+			character = 0
+		}
+		line += data[i]
+		character += data[i+1]
+
+		var modifiers []string
+		for j, modifier := range legend.TokenModifiers {
+			if data[i+4]&(1<<j) != 0 {
+				modifiers = append(modifiers, modifier)
+			}
+		}
+		tokens = append(tokens, decodedToken{
+			line:      line,
+			character: character,
+			length:    data[i+2],
+			tokenType: legend.TokenTypes[data[i+3]],
+			modifiers: modifiers,
+		})
+	}
+	return tokens
+}
+
+func eventsOf(events ...highlight.Event) func(yield func(highlight.Event, error) bool) {
+	return func(yield func(highlight.Event, error) bool) {
+		for _, event := range events {
+			if !yield(event, nil) {
+				return
+			}
+		}
+	}
+}
+
+func TestNewLegend(t *testing.T) {
+	legend, err := NewLegend([]string{
+		"function",
+		"function.builtin",
+		"punctuation.bracket",
+		"variable.parameter",
+		"markup.heading",
+		"comment.documentation",
+		"constant.builtin",
+		"function.method.call",
+	}, DefaultMapping)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"function", "parameter", "markup", "comment", "variable", "method"}, legend.TokenTypes)
+	assert.Equal(t, []string{"defaultLibrary", "documentation", "readonly"}, legend.TokenModifiers)
+	assert.Equal(t, []*token{
+		{tokenType: 0},
+		{tokenType: 0, modifiers: 0b1},
+		nil,
+		{tokenType: 1},
+		{tokenType: 2},
+		{tokenType: 3, modifiers: 0b10},
+		{tokenType: 4, modifiers: 0b101},
+		{tokenType: 5},
+	}, legend.tokens)
+}
+
+func TestNewLegend_TooManyModifiers(t *testing.T) {
+	mapping := Mapping{
+		Types:     map[string]string{"variable": "variable"},
+		Modifiers: make(map[string]string),
+	}
+	var captureNames []string
+	for i := range MaxTokenModifiers + 1 {
+		modifier := fmt.Sprintf("m%d", i)
+		mapping.Modifiers[modifier] = modifier
+		captureNames = append(captureNames, "variable."+modifier)
+	}
+
+	legend, err := NewLegend(captureNames[:MaxTokenModifiers], mapping)
+	require.NoError(t, err)
+	assert.Len(t, legend.TokenModifiers, MaxTokenModifiers)
+	assert.Equal(t, uint32(1<<31), legend.tokens[MaxTokenModifiers-1].modifiers)
+
+	_, err = NewLegend(captureNames, mapping)
+	assert.ErrorContains(t, err, "too many token modifiers")
+}
+
+func TestEncode_CarriageReturn(t *testing.T) {
+	legend, err := NewLegend([]string{"string"}, DefaultMapping)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		source   string
+		expected []uint32
+	}{
+		{
+			name:     "crlf",
+			source:   "ab\r\ncd",
+			expected: []uint32{0, 0, 2, 0, 0, 1, 0, 2, 0, 0},
+		},
+		{
+			name:     "lone carriage return",
+			source:   "ab\r",
+			expected: []uint32{0, 0, 3, 0, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := Encode(eventsOf(
+				highlight.EventLayerStart{LanguageName: "test"},
+				highlight.EventCaptureStart{Highlight: 0},
+				highlight.EventSource{StartByte: 0, EndByte: uint(len(tt.source))},
+				highlight.EventCaptureEnd{},
+			), []byte(tt.source), legend)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, data)
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	source := "ab\ncd ef"
+	legend, err := NewLegend([]string{"string", "punctuation", "keyword"}, DefaultMapping)
+	require.NoError(t, err)
+
+	data, err := Encode(eventsOf(
+		highlight.EventLayerStart{LanguageName: "test"},
+		highlight.EventCaptureStart{Highlight: 0},
+		highlight.EventSource{StartByte: 0, EndByte: 1, EndPoint: tree_sitter.Point{Column: 1}, EndUTF16Column: 1},
+		// the punctuation has no token type, so the string continues
+		highlight.EventCaptureStart{Highlight: 1},
+		highlight.EventSource{StartByte: 1, EndByte: 4, StartPoint: tree_sitter.Point{Column: 1}, StartUTF16Column: 1, EndPoint: tree_sitter.Point{Row: 1, Column: 1}, EndUTF16Column: 1},
+		highlight.EventCaptureEnd{},
+		highlight.EventSource{StartByte: 4, EndByte: 5, StartPoint: tree_sitter.Point{Row: 1, Column: 1}, StartUTF16Column: 1, EndPoint: tree_sitter.Point{Row: 1, Column: 2}, EndUTF16Column: 2},
+		highlight.EventCaptureEnd{},
+		highlight.EventSource{StartByte: 5, EndByte: 6, StartPoint: tree_sitter.Point{Row: 1, Column: 2}, StartUTF16Column: 2, EndPoint: tree_sitter.Point{Row: 1, Column: 3}, EndUTF16Column: 3},
+		highlight.EventCaptureStart{Highlight: 2},
+		highlight.EventSource{StartByte: 6, EndByte: 8, StartPoint: tree_sitter.Point{Row: 1, Column: 3}, StartUTF16Column: 3, EndPoint: tree_sitter.Point{Row: 1, Column: 5}, EndUTF16Column: 5},
+		highlight.EventCaptureEnd{},
+	), []byte(source), legend)
+	require.NoError(t, err)
+
+	assert.Equal(t, []uint32{
+		0, 0, 2, 0, 0,
+		1, 0, 2, 0, 0,
+		0, 3, 2, 1, 0,
+	}, data)
+}
+
+func TestEncode_Highlight(t *testing.T) {
+	source := []byte("package main\n\n/* a\n😀 b */\nfunc f(x int) { g(\"😀x\") }\n")
+
+	highlightsQuery, err := os.ReadFile("../testdata/queries/go/highlights.scm")
+	require.NoError(t, err)
+
+	cfg, err := highlight.NewConfiguration(tree_sitter.NewLanguage(tree_sitter_go.Language()), "go", highlightsQuery, nil, nil)
+	require.NoError(t, err)
+	defer cfg.Close()
+
+	cfg.Configure(highlight.StandardCaptureNames)
+	legend, err := NewLegend(highlight.StandardCaptureNames, DefaultMapping)
+	require.NoError(t, err)
+
+	highlighter := highlight.New()
+	defer highlighter.Close()
+
+	data, err := Encode(highlighter.Highlight(context.Background(), *cfg, source, nil), source, legend)
+	require.NoError(t, err)
+	tokens := decode(legend, data)
+
+	for _, expected := range []decodedToken{
+		{line: 0, character: 0, length: 7, tokenType: "keyword"},
+		{line: 0, character: 8, length: 4, tokenType: "namespace"},
+		{line: 2, character: 0, length: 4, tokenType: "comment"},
+		{line: 3, character: 0, length: 7, tokenType: "comment"},
+		{line: 4, character: 0, length: 4, tokenType: "keyword"},
+		{line: 4, character: 5, length: 1, tokenType: "function"},
+		{line: 4, character: 7, length: 1, tokenType: "parameter"},
+		{line: 4, character: 9, length: 3, tokenType: "type", modifiers: []string{"defaultLibrary"}},
+		{line: 4, character: 18, length: 5, tokenType: "string"},
+	} {
+		assert.Contains(t, tokens, expected)
+	}
+
+	// a range only contains the tokens of the range, with absolute positions
+	start := uint(len("package main\n\n/* a\n😀 b */\nfunc f("))
+	data, err = Encode(highlighter.HighlightRange(context.Background(), *cfg, source, nil, start, start+1), source, legend)
+	require.NoError(t, err)
+	assert.Equal(t, []decodedToken{{line: 4, character: 7, length: 1, tokenType: "parameter"}}, decode(legend, data))
+}
+
+func TestDelta(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous []uint32
+		current  []uint32
+		expected []Edit
+	}{
+		{
+			name:     "equal",
+			previous: []uint32{0, 0, 1, 0, 0, 1, 0, 2, 1, 0},
+			current:  []uint32{0, 0, 1, 0, 0, 1, 0, 2, 1, 0},
+			expected: nil,
+		},
+		{
+			name:     "changed token",
+			previous: []uint32{0, 0, 1, 0, 0, 1, 0, 2, 1, 0, 0, 3, 1, 0, 0},
+			current:  []uint32{0, 0, 1, 0, 0, 1, 0, 4, 1, 0, 0, 5, 1, 0, 0},
+			expected: []Edit{{Start: 5, DeleteCount: 10, Data: []uint32{1, 0, 4, 1, 0, 0, 5, 1, 0, 0}}},
+		},
+		{
+			name:     "inserted token",
+			previous: []uint32{0, 0, 1, 0, 0, 1, 0, 2, 1, 0},
+			current:  []uint32{0, 0, 1, 0, 0, 0, 2, 1, 2, 0, 1, 0, 2, 1, 0},
+			expected: []Edit{{Start: 5, DeleteCount: 0, Data: []uint32{0, 2, 1, 2, 0}}},
+		},
+		{
+			name:     "removed tokens",
+			previous: []uint32{0, 0, 1, 0, 0, 1, 0, 2, 1, 0},
+			current:  nil,
+			expected: []Edit{{Start: 0, DeleteCount: 10}},
+		},
+		{
+			name:     "repeated tokens",
+			previous: []uint32{0, 0, 1, 0, 0},
+			current:  []uint32{0, 0, 1, 0, 0, 0, 0, 1, 0, 0},
+			expected: []Edit{{Start: 5, DeleteCount: 0, Data: []uint32{0, 0, 1, 0, 0}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edits := Delta(tt.previous, tt.current)
+			assert.Equal(t, tt.expected, edits)
+
+			current := ApplyEdits(tt.previous, edits)
+			if len(tt.current) == 0 {
+				assert.Empty(t, current)
+			} else {
+				assert.Equal(t, tt.current, current)
+			}
+		})
+	}
+}
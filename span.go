@@ -0,0 +1,163 @@
+package highlight
+
+import (
+	"fmt"
+	"iter"
+	"slices"
+
+	"github.com/tree-sitter/go-tree-sitter"
+)
+
+// Span is a range of the source code with the language and all highlights covering it.
+// It has the same range fields as [EventSource], but it is not an [Event] itself.
+type Span struct {
+	StartByte uint
+	EndByte   uint
+	// StartPoint and EndPoint are the row and byte column of StartByte and EndByte, like the points of tree-sitter nodes.
+	StartPoint tree_sitter.Point
+	EndPoint   tree_sitter.Point
+	// StartUTF16Column and EndUTF16Column are the columns of StartByte and EndByte in UTF-16 code units, as used by LSP clients.
+	StartUTF16Column uint
+	EndUTF16Column   uint
+	// LanguageName is the name of the language layer of the range.
+	LanguageName string
+	// Highlights are the highlights covering the range, from the outermost to the innermost.
+	Highlights []Highlight
+}
+
+// Highlight returns the innermost highlight of the span or [DefaultHighlight] if the range is not highlighted.
+func (s Span) Highlight() Highlight {
+	if len(s.Highlights) == 0 {
+		return DefaultHighlight
+	}
+	return s.Highlights[len(s.Highlights)-1]
+}
+
+// source returns the source event of the range of the span.
+func (s Span) source() EventSource {
+	return EventSource{
+		StartByte:        s.StartByte,
+		EndByte:          s.EndByte,
+		StartPoint:       s.StartPoint,
+		EndPoint:         s.EndPoint,
+		StartUTF16Column: s.StartUTF16Column,
+		EndUTF16Column:   s.EndUTF16Column,
+	}
+}
+
+// newSpan returns the span of the range of the source event.
+func newSpan(e EventSource, languageName string, highlights []Highlight) Span {
+	return Span{
+		StartByte:        e.StartByte,
+		EndByte:          e.EndByte,
+		StartPoint:       e.StartPoint,
+		EndPoint:         e.EndPoint,
+		StartUTF16Column: e.StartUTF16Column,
+		EndUTF16Column:   e.EndUTF16Column,
+		LanguageName:     languageName,
+		Highlights:       highlights,
+	}
+}
+
+// CollectSpans collapses the events into non-overlapping spans in source order, so consumers don't need to keep track
+// of the captures and language layers themselves. Adjacent ranges with the same language and highlights are merged.
+// Ranges without highlights are included with no highlights.
+func CollectSpans(events iter.Seq2[Event, error]) ([]Span, error) {
+	var (
+		spans        []Span
+		highlights   []Highlight
+		languageName string
+	)
+	for event, err := range events {
+		if err != nil {
+			return nil, fmt.Errorf("error while collecting spans: %w", err)
+		}
+
+		switch e := event.(type) {
+		case EventLayerStart:
+			languageName = e.LanguageName
+		case EventLayerEnd:
+			languageName = ""
+		case EventCaptureStart:
+			highlights = append(highlights, e.Highlight)
+		case EventCaptureEnd:
+			highlights = highlights[:len(highlights)-1]
+		case EventSource:
+			spans = appendSpan(spans, e, languageName, highlights)
+		}
+	}
+
+	return spans, nil
+}
+
+// appendSpan appends the span of the source event to the spans or extends the last span if it continues it.
+func appendSpan(spans []Span, e EventSource, languageName string, highlights []Highlight) []Span {
+	if len(spans) > 0 {
+		last := &spans[len(spans)-1]
+		if last.EndByte == e.StartByte && last.LanguageName == languageName && slices.Equal(last.Highlights, highlights) {
+			last.EndByte = e.EndByte
+			last.EndPoint = e.EndPoint
+			last.EndUTF16Column = e.EndUTF16Column
+			return spans
+		}
+	}
+
+	if len(highlights) > 0 {
+		highlights = slices.Clone(highlights)
+	} else {
+		highlights = nil
+	}
+	return append(spans, newSpan(e, languageName, highlights))
+}
+
+// SpanEvents converts spans back into highlight events, so spans can be passed to the renderers.
+// Captures which are shared by adjacent spans are kept open and language layers are switched like
+// [Highlighter.Highlight] does.
+func SpanEvents(spans []Span) iter.Seq2[Event, error] {
+	return func(yield func(Event, error) bool) {
+		var (
+			highlights   []Highlight
+			languageName string
+			inLayer      bool
+		)
+		for _, span := range spans {
+			if !inLayer || span.LanguageName != languageName {
+				if inLayer && !yield(EventLayerEnd{}, nil) {
+					return
+				}
+				if !yield(EventLayerStart{LanguageName: span.LanguageName}, nil) {
+					return
+				}
+				languageName = span.LanguageName
+				inLayer = true
+			}
+
+			// keep the captures the spans have in common
+			common := 0
+			for common < min(len(highlights), len(span.Highlights)) && highlights[common] == span.Highlights[common] {
+				common++
+			}
+			for range len(highlights) - common {
+				if !yield(EventCaptureEnd{}, nil) {
+					return
+				}
+			}
+			for _, h := range span.Highlights[common:] {
+				if !yield(EventCaptureStart{Highlight: h}, nil) {
+					return
+				}
+			}
+			highlights = span.Highlights
+
+			if !yield(span.source(), nil) {
+				return
+			}
+		}
+
+		for range highlights {
+			if !yield(EventCaptureEnd{}, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package highlight
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectSpans(t *testing.T) {
+	events := eventsOf(
+		EventLayerStart{LanguageName: "html"},
+		EventSource{StartByte: 0, EndByte: 1},
+		EventCaptureStart{Highlight: 0},
+		EventSource{StartByte: 1, EndByte: 2},
+		EventLayerEnd{},
+		EventLayerStart{LanguageName: "javascript"},
+		EventCaptureStart{Highlight: 1},
+		EventSource{StartByte: 2, EndByte: 3},
+		EventSource{StartByte: 3, EndByte: 4},
+		EventCaptureEnd{},
+		EventSource{StartByte: 4, EndByte: 5},
+		EventCaptureEnd{},
+		EventSource{StartByte: 5, EndByte: 6},
+	)
+
+	spans, err := CollectSpans(events)
+	require.NoError(t, err)
+	assert.Equal(t, []Span{
+		{StartByte: 0, EndByte: 1, LanguageName: "html"},
+		{StartByte: 1, EndByte: 2, LanguageName: "html", Highlights: []Highlight{0}},
+		{StartByte: 2, EndByte: 4, LanguageName: "javascript", Highlights: []Highlight{0, 1}},
+		{StartByte: 4, EndByte: 5, LanguageName: "javascript", Highlights: []Highlight{0}},
+		{StartByte: 5, EndByte: 6, LanguageName: "javascript"},
+	}, spans)
+	assert.Equal(t, Highlight(1), spans[2].Highlight())
+	assert.Equal(t, DefaultHighlight, spans[0].Highlight())
+
+	assert.Equal(t, []Event{
+		EventLayerStart{LanguageName: "html"},
+		EventSource{StartByte: 0, EndByte: 1},
+		EventCaptureStart{Highlight: 0},
+		EventSource{StartByte: 1, EndByte: 2},
+		EventLayerEnd{},
+		EventLayerStart{LanguageName: "javascript"},
+		EventCaptureStart{Highlight: 1},
+		EventSource{StartByte: 2, EndByte: 4},
+		EventCaptureEnd{},
+		EventSource{StartByte: 4, EndByte: 5},
+		EventCaptureEnd{},
+		EventSource{StartByte: 5, EndByte: 6},
+	}, collectEvents(t, SpanEvents(spans)))
+}
+
+func TestSpan_NotEvent(t *testing.T) {
+	// spans must not be mistaken for source events
+	_, ok := any(Span{}).(Event)
+	assert.False(t, ok)
+}
+
+func TestSpanEvents_RoundTrip(t *testing.T) {
+	source := []byte("<div>\n<script>\nlet s = `a ${b}`; // c\n</script>\n<style>\na { color: red; }\n</style>\n</div>\n")
+	cfg := loadTestConfiguration(t, "html")
+
+	spans, err := CollectSpans(New().Highlight(context.Background(), *cfg, source, testInjectionCallback(t)))
+	require.NoError(t, err)
+	require.NotEmpty(t, spans)
+
+	// the spans cover the whole source without overlapping
+	var offset uint
+	for _, span := range spans {
+		assert.Equal(t, offset, span.StartByte)
+		assert.Less(t, span.StartByte, span.EndByte)
+		offset = span.EndByte
+	}
+	assert.Equal(t, uint(len(source)), offset)
+
+	expected := highlightNames(t, New().Highlight(context.Background(), *cfg, source, testInjectionCallback(t)), source, StandardCaptureNames)
+	assert.Equal(t, expected, highlightNames(t, SpanEvents(spans), source, StandardCaptureNames))
+
+	roundTrip, err := CollectSpans(SpanEvents(spans))
+	require.NoError(t, err)
+	assert.Equal(t, spans, roundTrip)
+}
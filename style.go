@@ -0,0 +1,246 @@
+package highlight
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ColorType is the type of a [Color].
+type ColorType uint8
+
+const (
+	// ColorNone is no color, the color of the surrounding highlight or the terminal default is used.
+	ColorNone ColorType = iota
+	// ColorIndexed is a color of the 256 color palette. The first 16 colors are the basic ANSI colors.
+	ColorIndexed
+	// ColorRGB is a 24-bit color.
+	ColorRGB
+)
+
+// Color is a color of a [Style]. The zero value is no color.
+type Color struct {
+	Type  ColorType
+	Index uint8
+	R     uint8
+	G     uint8
+	B     uint8
+}
+
+// IndexedColor returns a color of the 256 color palette.
+func IndexedColor(index uint8) Color {
+	return Color{Type: ColorIndexed, Index: index}
+}
+
+// RGBColor returns a 24-bit color.
+func RGBColor(r uint8, g uint8, b uint8) Color {
+	return Color{Type: ColorRGB, R: r, G: g, B: b}
+}
+
+// ParseColor parses a color in the form "#rrggbb", "#rgb" or a palette index from 0 to 255.
+// An empty string is no color.
+func ParseColor(s string) (Color, error) {
+	if s == "" {
+		return Color{}, nil
+	}
+
+	if hex, ok := strings.CutPrefix(s, "#"); ok {
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		if len(hex) != 6 {
+			return Color{}, fmt.Errorf("invalid color %q", s)
+		}
+		rgb, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil {
+			return Color{}, fmt.Errorf("invalid color %q: %w", s, err)
+		}
+		return RGBColor(uint8(rgb>>16), uint8(rgb>>8), uint8(rgb)), nil
+	}
+
+	index, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return Color{}, fmt.Errorf("invalid color %q: %w", s, err)
+	}
+	return IndexedColor(uint8(index)), nil
+}
+
+// IsSet reports whether the color is not [ColorNone].
+func (c Color) IsSet() bool {
+	return c.Type != ColorNone
+}
+
+// RGB returns the red, green and blue components of the color. Palette colors are converted using the xterm default palette.
+func (c Color) RGB() (uint8, uint8, uint8) {
+	switch c.Type {
+	case ColorRGB:
+		return c.R, c.G, c.B
+	case ColorIndexed:
+		switch {
+		case c.Index < 16:
+			rgb := ansiPalette[c.Index]
+			return rgb[0], rgb[1], rgb[2]
+		case c.Index < 232:
+			i := c.Index - 16
+			return cubeLevels[i/36], cubeLevels[i/6%6], cubeLevels[i%6]
+		default:
+			grey := 8 + 10*(c.Index-232)
+			return grey, grey, grey
+		}
+	default:
+		return 0, 0, 0
+	}
+}
+
+// String returns the color in the form accepted by [ParseColor].
+func (c Color) String() string {
+	switch c.Type {
+	case ColorIndexed:
+		return strconv.Itoa(int(c.Index))
+	case ColorRGB:
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	default:
+		return ""
+	}
+}
+
+// to256 returns the closest color of the 256 color palette.
+func (c Color) to256() Color {
+	if c.Type != ColorRGB {
+		return c
+	}
+
+	// find the closest color of the color cube and the grey ramp, the same way tmux does
+	r, g, b := int(c.R), int(c.G), int(c.B)
+	qr, qg, qb := cubeIndex(r), cubeIndex(g), cubeIndex(b)
+	cr, cg, cb := int(cubeLevels[qr]), int(cubeLevels[qg]), int(cubeLevels[qb])
+	if cr == r && cg == g && cb == b {
+		return IndexedColor(uint8(16 + 36*qr + 6*qg + qb))
+	}
+
+	greyAvg := (r + g + b) / 3
+	greyIndex := 23
+	if greyAvg <= 238 {
+		greyIndex = (greyAvg - 3) / 10
+	}
+	grey := 8 + 10*greyIndex
+
+	if colorDistance(r, g, b, grey, grey, grey) < colorDistance(r, g, b, cr, cg, cb) {
+		return IndexedColor(uint8(232 + greyIndex))
+	}
+	return IndexedColor(uint8(16 + 36*qr + 6*qg + qb))
+}
+
+// to16 returns the closest of the 16 basic ANSI colors.
+func (c Color) to16() Color {
+	if c.Type == ColorNone || (c.Type == ColorIndexed && c.Index < 16) {
+		return c
+	}
+
+	r, g, b := c.RGB()
+	var closest uint8
+	closestDistance := -1
+	for i, rgb := range ansiPalette {
+		distance := colorDistance(int(r), int(g), int(b), int(rgb[0]), int(rgb[1]), int(rgb[2]))
+		if closestDistance == -1 || distance < closestDistance {
+			closest = uint8(i)
+			closestDistance = distance
+		}
+	}
+	return IndexedColor(closest)
+}
+
+// ansiPalette is the xterm default palette of the 16 basic ANSI colors.
+var ansiPalette = [16][3]uint8{
+	{0x00, 0x00, 0x00},
+	{0xcd, 0x00, 0x00},
+	{0x00, 0xcd, 0x00},
+	{0xcd, 0xcd, 0x00},
+	{0x00, 0x00, 0xee},
+	{0xcd, 0x00, 0xcd},
+	{0x00, 0xcd, 0xcd},
+	{0xe5, 0xe5, 0xe5},
+	{0x7f, 0x7f, 0x7f},
+	{0xff, 0x00, 0x00},
+	{0x00, 0xff, 0x00},
+	{0xff, 0xff, 0x00},
+	{0x5c, 0x5c, 0xff},
+	{0xff, 0x00, 0xff},
+	{0x00, 0xff, 0xff},
+	{0xff, 0xff, 0xff},
+}
+
+// cubeLevels are the levels of each component of the 6x6x6 color cube of the 256 color palette.
+var cubeLevels = [6]uint8{0x00, 0x5f, 0x87, 0xaf, 0xd7, 0xff}
+
+func cubeIndex(v int) int {
+	switch {
+	case v < 48:
+		return 0
+	case v < 115:
+		return 1
+	default:
+		return (v - 35) / 40
+	}
+}
+
+func colorDistance(r1 int, g1 int, b1 int, r2 int, g2 int, b2 int) int {
+	return (r1-r2)*(r1-r2) + (g1-g2)*(g1-g2) + (b1-b2)*(b1-b2)
+}
+
+// Style is the text style of a highlight.
+type Style struct {
+	Foreground    Color
+	Background    Color
+	Bold          bool
+	Italic        bool
+	Underline     bool
+	Strikethrough bool
+}
+
+// IsZero reports whether the style has no colors and no attributes.
+func (s Style) IsZero() bool {
+	return s == Style{}
+}
+
+// Inherit returns the style with the unset colors taken from the parent style and the attributes of both styles combined.
+func (s Style) Inherit(parent Style) Style {
+	if !s.Foreground.IsSet() {
+		s.Foreground = parent.Foreground
+	}
+	if !s.Background.IsSet() {
+		s.Background = parent.Background
+	}
+	s.Bold = s.Bold || parent.Bold
+	s.Italic = s.Italic || parent.Italic
+	s.Underline = s.Underline || parent.Underline
+	s.Strikethrough = s.Strikethrough || parent.Strikethrough
+	return s
+}
+
+// CSS returns the style as CSS declarations, e.g. "color:#ff0000;font-weight:bold;".
+// Palette colors are converted using the xterm default palette.
+func (s Style) CSS() string {
+	var b strings.Builder
+	if s.Foreground.IsSet() {
+		b.WriteString("color:" + RGBColor(s.Foreground.RGB()).String() + ";")
+	}
+	if s.Background.IsSet() {
+		b.WriteString("background-color:" + RGBColor(s.Background.RGB()).String() + ";")
+	}
+	if s.Bold {
+		b.WriteString("font-weight:bold;")
+	}
+	if s.Italic {
+		b.WriteString("font-style:italic;")
+	}
+	switch {
+	case s.Underline && s.Strikethrough:
+		b.WriteString("text-decoration:underline line-through;")
+	case s.Underline:
+		b.WriteString("text-decoration:underline;")
+	case s.Strikethrough:
+		b.WriteString("text-decoration:line-through;")
+	}
+	return b.String()
+}
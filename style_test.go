@@ -0,0 +1,94 @@
+package highlight
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		name      string
+		color     string
+		expected  Color
+		expectErr bool
+	}{
+		{name: "empty", color: "", expected: Color{}},
+		{name: "hex", color: "#1e90ff", expected: RGBColor(0x1e, 0x90, 0xff)},
+		{name: "short hex", color: "#f80", expected: RGBColor(0xff, 0x88, 0x00)},
+		{name: "index", color: "208", expected: IndexedColor(208)},
+		{name: "invalid hex", color: "#12345", expectErr: true},
+		{name: "invalid hex digits", color: "#gggggg", expectErr: true},
+		{name: "index out of range", color: "256", expectErr: true},
+		{name: "name", color: "red", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			color, err := ParseColor(tt.color)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, color)
+
+			parsed, err := ParseColor(color.String())
+			assert.NoError(t, err)
+			assert.Equal(t, color, parsed)
+		})
+	}
+}
+
+func TestColor_Convert(t *testing.T) {
+	tests := []struct {
+		name        string
+		color       Color
+		expected256 Color
+		expected16  Color
+	}{
+		{name: "none", color: Color{}, expected256: Color{}, expected16: Color{}},
+		{name: "basic", color: IndexedColor(4), expected256: IndexedColor(4), expected16: IndexedColor(4)},
+		{name: "cube", color: RGBColor(0xff, 0x00, 0x00), expected256: IndexedColor(196), expected16: IndexedColor(9)},
+		{name: "close to cube", color: RGBColor(0x1e, 0x90, 0xff), expected256: IndexedColor(33), expected16: IndexedColor(12)},
+		{name: "grey", color: RGBColor(0x80, 0x80, 0x80), expected256: IndexedColor(244), expected16: IndexedColor(8)},
+		{name: "palette", color: IndexedColor(226), expected256: IndexedColor(226), expected16: IndexedColor(11)},
+		{name: "palette grey", color: IndexedColor(255), expected256: IndexedColor(255), expected16: IndexedColor(7)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected256, tt.color.to256())
+			assert.Equal(t, tt.expected16, tt.color.to16())
+		})
+	}
+}
+
+func TestStyle_Inherit(t *testing.T) {
+	parent := Style{Foreground: IndexedColor(1), Background: IndexedColor(0), Bold: true}
+
+	assert.Equal(t, parent, Style{}.Inherit(parent))
+	assert.Equal(t,
+		Style{Foreground: IndexedColor(2), Background: IndexedColor(0), Bold: true, Italic: true},
+		Style{Foreground: IndexedColor(2), Italic: true}.Inherit(parent),
+	)
+}
+
+func TestStyle_CSS(t *testing.T) {
+	tests := []struct {
+		name     string
+		style    Style
+		expected string
+	}{
+		{name: "empty", style: Style{}, expected: ""},
+		{name: "colors", style: Style{Foreground: RGBColor(0xff, 0x00, 0x00), Background: IndexedColor(4)}, expected: "color:#ff0000;background-color:#0000ee;"},
+		{name: "attributes", style: Style{Bold: true, Italic: true, Underline: true, Strikethrough: true}, expected: "font-weight:bold;font-style:italic;text-decoration:underline line-through;"},
+		{name: "strikethrough", style: Style{Strikethrough: true}, expected: "text-decoration:line-through;"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.style.CSS())
+		})
+	}
+}
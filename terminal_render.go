@@ -0,0 +1,198 @@
+package highlight
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"iter"
+	"strconv"
+	"strings"
+)
+
+// ColorMode is the number of colors a terminal supports.
+type ColorMode uint8
+
+const (
+	// ColorMode16 uses the 16 basic ANSI colors. Other colors are replaced by the closest basic color.
+	ColorMode16 ColorMode = iota
+	// ColorMode256 uses the 256 color palette. 24-bit colors are replaced by the closest palette color.
+	ColorMode256
+	// ColorModeTrueColor uses 24-bit colors.
+	ColorModeTrueColor
+)
+
+// StyleCallback is a callback function that returns the style for a highlight.
+// It is called with [DefaultHighlight] when a language layer starts to get the base style of the layer.
+type StyleCallback func(h Highlight, languageName string) Style
+
+// NewTerminalRender returns a new TerminalRender for the given color mode.
+func NewTerminalRender(colorMode ColorMode) *TerminalRender {
+	return &TerminalRender{
+		ColorMode: colorMode,
+	}
+}
+
+// TerminalRender is a renderer that outputs text with ANSI escape sequences.
+type TerminalRender struct {
+	ColorMode ColorMode
+}
+
+// Render renders the source code to the writer with ANSI escape sequences for the style of each highlight capture.
+// The [StyleCallback] is used to get the style of each highlight, unset colors and attributes are inherited from the
+// surrounding highlights and the base style of the language layer.
+// Styles are reset at the end of each line and restored at the start of the next one,
+// so the output can be displayed line by line, e.g. by pagers like less -R.
+func (r *TerminalRender) Render(w io.Writer, events iter.Seq2[Event, error], source []byte, callback StyleCallback) error {
+	tw := &terminalWriter{
+		w:         w,
+		colorMode: r.ColorMode,
+	}
+
+	var (
+		// styles are the styles of the open captures, each inheriting from the previous one
+		styles       []Style
+		languageName string
+		// layerStyle is the base style of the current language layer
+		layerStyle Style
+	)
+	currentStyle := func() Style {
+		if len(styles) == 0 {
+			return Style{}
+		}
+		return styles[len(styles)-1]
+	}
+	for event, err := range events {
+		if err != nil {
+			return fmt.Errorf("error while rendering: %w", err)
+		}
+
+		switch e := event.(type) {
+		case EventLayerStart:
+			languageName = e.LanguageName
+			layerStyle = callback(DefaultHighlight, e.LanguageName)
+		case EventLayerEnd:
+			languageName = ""
+			layerStyle = Style{}
+		case EventCaptureStart:
+			styles = append(styles, callback(e.Highlight, languageName).Inherit(currentStyle()))
+		case EventCaptureEnd:
+			styles = styles[:len(styles)-1]
+		case EventSource:
+			if err = tw.writeText(source[e.StartByte:e.EndByte], currentStyle().Inherit(layerStyle)); err != nil {
+				return fmt.Errorf("error while writing source: %w", err)
+			}
+		}
+	}
+
+	if err := tw.setStyle(Style{}); err != nil {
+		return fmt.Errorf("error while resetting style: %w", err)
+	}
+
+	return nil
+}
+
+// terminalWriter writes text with ANSI escape sequences. It only writes escape sequences when the style of the text changes.
+type terminalWriter struct {
+	w         io.Writer
+	colorMode ColorMode
+	active    Style
+}
+
+// writeText writes the text with the style. The style is reset before each line break.
+func (t *terminalWriter) writeText(text []byte, style Style) error {
+	for len(text) > 0 {
+		line, rest, found := bytes.Cut(text, []byte("\n"))
+		text = rest
+
+		newline := "\n"
+		if found && bytes.HasSuffix(line, []byte("\r")) {
+			line = line[:len(line)-1]
+			newline = "\r\n"
+		}
+
+		if len(line) > 0 {
+			if err := t.setStyle(style); err != nil {
+				return err
+			}
+			if _, err := t.w.Write(line); err != nil {
+				return err
+			}
+		}
+
+		if found {
+			if err := t.setStyle(Style{}); err != nil {
+				return err
+			}
+			if _, err := io.WriteString(t.w, newline); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// setStyle writes the escape sequences to switch from the active style to the given style.
+func (t *terminalWriter) setStyle(style Style) error {
+	if style == t.active {
+		return nil
+	}
+
+	if !t.active.IsZero() {
+		if _, err := io.WriteString(t.w, "\x1b[0m"); err != nil {
+			return err
+		}
+	}
+	t.active = style
+
+	if style.IsZero() {
+		return nil
+	}
+	_, err := io.WriteString(t.w, "\x1b["+t.sgrParameters(style)+"m")
+	return err
+}
+
+// sgrParameters returns the select graphic rendition parameters of the style.
+func (t *terminalWriter) sgrParameters(style Style) string {
+	var parameters []string
+	if style.Bold {
+		parameters = append(parameters, "1")
+	}
+	if style.Italic {
+		parameters = append(parameters, "3")
+	}
+	if style.Underline {
+		parameters = append(parameters, "4")
+	}
+	if style.Strikethrough {
+		parameters = append(parameters, "9")
+	}
+	if style.Foreground.IsSet() {
+		parameters = append(parameters, t.colorParameters(style.Foreground, 30, 90, 38))
+	}
+	if style.Background.IsSet() {
+		parameters = append(parameters, t.colorParameters(style.Background, 40, 100, 48))
+	}
+	return strings.Join(parameters, ";")
+}
+
+// colorParameters returns the parameters of a foreground or background color converted to the color mode.
+func (t *terminalWriter) colorParameters(color Color, basic int, bright int, extended int) string {
+	switch t.colorMode {
+	case ColorMode16:
+		color = color.to16()
+	case ColorMode256:
+		color = color.to256()
+	}
+
+	switch {
+	case color.Type == ColorIndexed && color.Index < 8:
+		return strconv.Itoa(basic + int(color.Index))
+	case color.Type == ColorIndexed && color.Index < 16:
+		return strconv.Itoa(bright + int(color.Index) - 8)
+	case color.Type == ColorIndexed:
+		return fmt.Sprintf("%d;5;%d", extended, color.Index)
+	default:
+		return fmt.Sprintf("%d;2;%d;%d;%d", extended, color.R, color.G, color.B)
+	}
+}
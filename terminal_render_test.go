@@ -0,0 +1,173 @@
+package highlight
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"iter"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// eventsOf returns an event iterator which yields the given events.
+func eventsOf(events ...Event) iter.Seq2[Event, error] {
+	return func(yield func(Event, error) bool) {
+		for _, event := range events {
+			if !yield(event, nil) {
+				return
+			}
+		}
+	}
+}
+
+func TestTerminalRender_Render(t *testing.T) {
+	styles := map[Highlight]Style{
+		0: {Foreground: RGBColor(0xff, 0x00, 0x00), Bold: true},
+		1: {Underline: true},
+		2: {Foreground: IndexedColor(4), Italic: true},
+	}
+	callback := func(h Highlight, languageName string) Style {
+		if h == DefaultHighlight {
+			if languageName == "css" {
+				return Style{Background: RGBColor(0x80, 0x80, 0x80)}
+			}
+			return Style{}
+		}
+		return styles[h]
+	}
+
+	tests := []struct {
+		name      string
+		source    string
+		events    []Event
+		colorMode ColorMode
+		expected  string
+	}{
+		{
+			name:   "nested captures",
+			source: "abc\ndef\n",
+			events: []Event{
+				EventLayerStart{LanguageName: "go"},
+				EventCaptureStart{Highlight: 0},
+				EventSource{StartByte: 0, EndByte: 2},
+				EventCaptureStart{Highlight: 1},
+				EventSource{StartByte: 2, EndByte: 5},
+				EventCaptureEnd{},
+				EventSource{StartByte: 5, EndByte: 6},
+				EventCaptureEnd{},
+				EventSource{StartByte: 6, EndByte: 8},
+			},
+			colorMode: ColorModeTrueColor,
+			expected:  "\x1b[1;38;2;255;0;0mab\x1b[0m\x1b[1;4;38;2;255;0;0mc\x1b[0m\n\x1b[1;4;38;2;255;0;0md\x1b[0m\x1b[1;38;2;255;0;0me\x1b[0mf\n",
+		},
+		{
+			name:   "256 colors",
+			source: "ab",
+			events: []Event{
+				EventLayerStart{LanguageName: "go"},
+				EventCaptureStart{Highlight: 0},
+				EventSource{StartByte: 0, EndByte: 1},
+				EventCaptureEnd{},
+				EventCaptureStart{Highlight: 2},
+				EventSource{StartByte: 1, EndByte: 2},
+				EventCaptureEnd{},
+			},
+			colorMode: ColorMode256,
+			expected:  "\x1b[1;38;5;196ma\x1b[0m\x1b[3;34mb\x1b[0m",
+		},
+		{
+			name:   "16 colors",
+			source: "ab",
+			events: []Event{
+				EventLayerStart{LanguageName: "go"},
+				EventCaptureStart{Highlight: 0},
+				EventSource{StartByte: 0, EndByte: 1},
+				EventCaptureEnd{},
+				EventCaptureStart{Highlight: 2},
+				EventSource{StartByte: 1, EndByte: 2},
+				EventCaptureEnd{},
+			},
+			colorMode: ColorMode16,
+			expected:  "\x1b[1;91ma\x1b[0m\x1b[3;34mb\x1b[0m",
+		},
+		{
+			name:   "injected layer",
+			source: "a{b}\r\nc",
+			events: []Event{
+				EventLayerStart{LanguageName: "html"},
+				EventCaptureStart{Highlight: 2},
+				EventSource{StartByte: 0, EndByte: 1},
+				EventLayerEnd{},
+				EventLayerStart{LanguageName: "css"},
+				EventSource{StartByte: 1, EndByte: 2},
+				EventCaptureStart{Highlight: 0},
+				EventSource{StartByte: 2, EndByte: 3},
+				EventCaptureEnd{},
+				EventSource{StartByte: 3, EndByte: 4},
+				EventLayerEnd{},
+				EventLayerStart{LanguageName: "html"},
+				EventSource{StartByte: 4, EndByte: 6},
+				EventCaptureEnd{},
+				EventSource{StartByte: 6, EndByte: 7},
+			},
+			colorMode: ColorMode256,
+			expected:  "\x1b[3;34ma\x1b[0m\x1b[3;34;48;5;244m{\x1b[0m\x1b[1;3;38;5;196;48;5;244mb\x1b[0m\x1b[3;34;48;5;244m}\x1b[0m\r\nc",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := NewTerminalRender(tt.colorMode).Render(&buf, eventsOf(tt.events...), []byte(tt.source), callback)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, buf.String())
+		})
+	}
+}
+
+func TestTerminalRender_RenderError(t *testing.T) {
+	events := func(yield func(Event, error) bool) {
+		if !yield(EventLayerStart{LanguageName: "go"}, nil) {
+			return
+		}
+		yield(nil, errors.New("parse error"))
+	}
+
+	var buf bytes.Buffer
+	err := NewTerminalRender(ColorModeTrueColor).Render(&buf, events, nil, func(Highlight, string) Style {
+		return Style{}
+	})
+	assert.ErrorContains(t, err, "parse error")
+}
+
+func TestTerminalRender_RenderLines(t *testing.T) {
+	source, err := os.ReadFile("testdata/test.go")
+	require.NoError(t, err)
+
+	cfg := loadTestConfiguration(t, "go")
+	callback := func(h Highlight, languageName string) Style {
+		if h == DefaultHighlight {
+			return Style{}
+		}
+		return Style{Foreground: IndexedColor(uint8(h)), Bold: h%2 == 0}
+	}
+
+	var buf bytes.Buffer
+	err = NewTerminalRender(ColorMode256).Render(&buf, New().Highlight(context.Background(), *cfg, source, nil), source, callback)
+	require.NoError(t, err)
+
+	escapes := regexp.MustCompile("\x1b\\[[0-9;]*m")
+	assert.Equal(t, string(source), escapes.ReplaceAllString(buf.String(), ""))
+
+	// every line resets its style, so it can be displayed on its own
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.Contains(line, "\x1b[") {
+			assert.True(t, strings.HasSuffix(line, "\x1b[0m"), "line %q does not reset its style", line)
+		}
+	}
+}
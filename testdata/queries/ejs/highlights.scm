@@ -0,0 +1,15 @@
+; Forked from tree-sitter-embedded-template
+; Copyright (c) 2014 Max Brunsfeld (The MIT License)
+;
+(comment_directive) @comment
+
+[
+  "<%#"
+  "<%"
+  "<%="
+  "<%_"
+  "<%-"
+  "%>"
+  "-%>"
+  "_%>"
+] @keyword
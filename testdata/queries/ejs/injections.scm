@@ -0,0 +1,10 @@
+; Forked from tree-sitter-embedded-template
+; Copyright (c) 2014 Max Brunsfeld (The MIT License)
+;
+((content) @injection.content
+ (#set! injection.language "html")
+ (#set! injection.combined))
+
+((code) @injection.content
+ (#set! injection.language "javascript")
+ (#set! injection.combined))
@@ -0,0 +1,16 @@
+; Forked from tree-sitter-html
+; Copyright (c) 2014 Max Brunsfeld (The MIT License)
+;
+(tag_name) @tag
+(erroneous_end_tag_name) @tag.error
+(doctype) @constant
+(attribute_name) @attribute
+(attribute_value) @string
+(comment) @comment
+
+[
+  "<"
+  ">"
+  "</"
+  "/>"
+] @punctuation.bracket
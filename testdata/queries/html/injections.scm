@@ -0,0 +1,10 @@
+; Forked from tree-sitter-html
+; Copyright (c) 2014 Max Brunsfeld (The MIT License)
+;
+((script_element
+  (raw_text) @injection.content)
+ (#set! injection.language "javascript"))
+
+((style_element
+  (raw_text) @injection.content)
+ (#set! injection.language "css"))
@@ -0,0 +1,96 @@
+package highlight
+
+import (
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Theme maps capture names to styles. It is used by the renderers to style the highlights and provides the list of
+// recognized names for [Configuration.Configure].
+type Theme struct {
+	// Name is the display name of the theme.
+	Name string
+	// Default is the style of text which is not highlighted, e.g. the background and foreground color of the editor.
+	Default Style
+	// Styles are the styles of the capture names like "keyword" or "function.builtin".
+	Styles map[string]Style
+	// Languages are styles for capture names which only apply to the language with the given name.
+	// They take precedence over Styles with the same capture name.
+	Languages map[string]map[string]Style
+}
+
+// Names returns the sorted capture names of the theme, including those of the language specific styles.
+// Pass them to [Configuration.Configure] or [Registry.Configure] to recognize exactly the highlights of the theme.
+func (t *Theme) Names() []string {
+	names := make(map[string]struct{}, len(t.Styles))
+	for name := range t.Styles {
+		names[name] = struct{}{}
+	}
+	for _, styles := range t.Languages {
+		for name := range styles {
+			names[name] = struct{}{}
+		}
+	}
+
+	return slices.Sorted(maps.Keys(names))
+}
+
+// Resolve returns the style of a capture name in a language. Like [Configuration.Configure], it falls back to the
+// parent names of a dot-separated capture name, so "function.builtin.static" uses the style of "function.builtin" or "function".
+// At each level, a style of the language takes precedence over a general style.
+func (t *Theme) Resolve(captureName string, languageName string) (Style, bool) {
+	for {
+		if style, ok := t.Languages[languageName][captureName]; ok {
+			return style, true
+		}
+		if style, ok := t.Styles[captureName]; ok {
+			return style, true
+		}
+
+		lastDot := strings.LastIndex(captureName, ".")
+		if lastDot == -1 {
+			return Style{}, false
+		}
+		captureName = captureName[:lastDot]
+	}
+}
+
+// StyleCallback returns a [StyleCallback] for the [TerminalRender] which resolves the highlights using the capture names
+// the configurations were configured with. [DefaultHighlight] uses the Default style of the theme.
+func (t *Theme) StyleCallback(captureNames []string) StyleCallback {
+	return func(h Highlight, languageName string) Style {
+		if h == DefaultHighlight {
+			return t.Default
+		}
+		if int(h) >= len(captureNames) {
+			return Style{}
+		}
+
+		style, _ := t.Resolve(captureNames[h], languageName)
+		return style
+	}
+}
+
+// hasLanguageStyle reports whether the theme has a language specific style for the capture name or one of its parent names.
+func (t *Theme) hasLanguageStyle(captureName string, languageName string) bool {
+	styles, ok := t.Languages[languageName]
+	if !ok {
+		return false
+	}
+
+	for {
+		if _, ok = styles[captureName]; ok {
+			return true
+		}
+		if _, ok = t.Styles[captureName]; ok {
+			return false
+		}
+
+		lastDot := strings.LastIndex(captureName, ".")
+		if lastDot == -1 {
+			return false
+		}
+		captureName = captureName[:lastDot]
+	}
+}
@@ -0,0 +1,105 @@
+package theme
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+
+	"go.gopad.dev/go-tree-sitter-highlight"
+)
+
+type base16Scheme struct {
+	Scheme  string            `yaml:"scheme"`
+	Name    string            `yaml:"name"`
+	Palette map[string]string `yaml:"palette"`
+}
+
+// base16Captures maps the capture names to the base16 colors following the base16 styling guidelines.
+var base16Captures = map[string]string{
+	"attribute":             "base09",
+	"boolean":               "base09",
+	"comment":               "base03",
+	"comment.documentation": "base03",
+	"constant":              "base09",
+	"constant.builtin":      "base09",
+	"constructor":           "base0A",
+	"embedded":              "base0F",
+	"error":                 "base08",
+	"function":              "base0D",
+	"function.builtin":      "base0D",
+	"keyword":               "base0E",
+	"markup.bold":           "base0A",
+	"markup.heading":        "base0D",
+	"markup.italic":         "base0E",
+	"markup.link":           "base08",
+	"markup.link.url":       "base09",
+	"markup.list":           "base08",
+	"markup.quote":          "base0C",
+	"markup.raw":            "base0B",
+	"markup.strikethrough":  "base03",
+	"module":                "base0A",
+	"number":                "base09",
+	"operator":              "base05",
+	"property":              "base08",
+	"punctuation":           "base05",
+	"punctuation.special":   "base0F",
+	"string":                "base0B",
+	"string.escape":         "base0C",
+	"string.regexp":         "base0C",
+	"string.special":        "base0C",
+	"tag":                   "base08",
+	"type":                  "base0A",
+	"type.builtin":          "base0A",
+	"variable":              "base08",
+	"variable.builtin":      "base09",
+	"variable.member":       "base08",
+	"variable.parameter":    "base08",
+}
+
+// ParseBase16 parses a base16 color scheme. Both the original format with the colors at the top level and the
+// newer format with a palette are supported. The colors are mapped to capture names following the base16 styling guidelines.
+func ParseBase16(data []byte) (*highlight.Theme, error) {
+	var scheme base16Scheme
+	if err := yaml.Unmarshal(data, &scheme); err != nil {
+		return nil, fmt.Errorf("error parsing base16 scheme: %w", err)
+	}
+	if scheme.Palette == nil {
+		// the original format has the colors at the top level
+		if err := yaml.Unmarshal(data, &scheme.Palette); err != nil {
+			return nil, fmt.Errorf("error parsing base16 scheme: %w", err)
+		}
+	}
+
+	colors := make(map[string]highlight.Color, 16)
+	for i := range 16 {
+		name := fmt.Sprintf("base%02X", i)
+		color, err := parseHexColor(scheme.Palette[name])
+		if err != nil {
+			return nil, fmt.Errorf("error parsing base16 scheme color %s: %w", name, err)
+		}
+		colors[name] = color
+	}
+
+	theme := &highlight.Theme{
+		Name: scheme.Name,
+		Default: highlight.Style{
+			Foreground: colors["base05"],
+			Background: colors["base00"],
+		},
+		Styles: make(map[string]highlight.Style, len(base16Captures)),
+	}
+	if theme.Name == "" {
+		theme.Name = scheme.Scheme
+	}
+
+	for capture, color := range base16Captures {
+		theme.Styles[capture] = highlight.Style{
+			Foreground:    colors[color],
+			Bold:          capture == "markup.bold" || capture == "markup.heading",
+			Italic:        capture == "markup.italic",
+			Strikethrough: capture == "markup.strikethrough",
+		}
+	}
+
+	return theme, nil
+}
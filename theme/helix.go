@@ -0,0 +1,171 @@
+package theme
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+
+	"go.gopad.dev/go-tree-sitter-highlight"
+)
+
+// helixColors are the named terminal colors of Helix themes.
+var helixColors = map[string]uint8{
+	"black":         0,
+	"red":           1,
+	"green":         2,
+	"yellow":        3,
+	"blue":          4,
+	"magenta":       5,
+	"cyan":          6,
+	"light-gray":    7,
+	"gray":          8,
+	"light-red":     9,
+	"light-green":   10,
+	"light-yellow":  11,
+	"light-blue":    12,
+	"light-magenta": 13,
+	"light-cyan":    14,
+	"white":         15,
+}
+
+// helixSkipped are the keys of Helix themes which style the editor instead of syntax highlights.
+var helixSkipped = []string{"ui", "diagnostic", "warning", "error", "info", "hint"}
+
+// ParseHelix parses a Helix theme. The keys of a Helix theme are tree-sitter capture names,
+// "ui.background" and "ui.text" are used as the default style and other editor styles are skipped.
+// Themes which inherit from another theme with "inherits" only contain their own styles.
+func ParseHelix(data []byte) (*highlight.Theme, error) {
+	var values map[string]any
+	if err := toml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("error parsing helix theme: %w", err)
+	}
+
+	palette := make(map[string]string)
+	if p, ok := values["palette"].(map[string]any); ok {
+		for name, value := range p {
+			if color, ok := value.(string); ok {
+				palette[name] = color
+			}
+		}
+	}
+
+	delete(values, "palette")
+	delete(values, "inherits")
+	styles := make(map[string]any)
+	flattenHelixStyles(styles, "", values)
+
+	theme := &highlight.Theme{
+		Styles: make(map[string]highlight.Style),
+	}
+	for name, value := range styles {
+		if isHelixSkipped(name) && name != "ui.background" && name != "ui.text" {
+			continue
+		}
+
+		style, err := parseHelixStyle(palette, value)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing helix style %q: %w", name, err)
+		}
+
+		switch {
+		case name == "ui.background":
+			theme.Default.Background = style.Background
+		case name == "ui.text":
+			theme.Default.Foreground = style.Foreground
+		default:
+			theme.Styles[name] = style
+		}
+	}
+
+	return theme, nil
+}
+
+// flattenHelixStyles adds the styles of the values to the styles by their dot-separated name.
+// Tables which are not a style contain nested names.
+func flattenHelixStyles(styles map[string]any, prefix string, values map[string]any) {
+	for key, value := range values {
+		if table, ok := value.(map[string]any); ok && !isHelixStyle(table) {
+			flattenHelixStyles(styles, prefix+key+".", table)
+			continue
+		}
+		styles[prefix+key] = value
+	}
+}
+
+func isHelixSkipped(name string) bool {
+	for _, skipped := range helixSkipped {
+		if name == skipped || strings.HasPrefix(name, skipped+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func isHelixStyle(table map[string]any) bool {
+	for _, key := range []string{"fg", "bg", "modifiers", "underline"} {
+		if _, ok := table[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHelixStyle parses a style which is either a foreground color or a table with fg, bg, modifiers and underline.
+func parseHelixStyle(palette map[string]string, value any) (highlight.Style, error) {
+	if color, ok := value.(string); ok {
+		foreground, err := parseHelixColor(palette, color)
+		return highlight.Style{Foreground: foreground}, err
+	}
+
+	table, ok := value.(map[string]any)
+	if !ok {
+		return highlight.Style{}, fmt.Errorf("invalid style %v", value)
+	}
+
+	var style highlight.Style
+	var err error
+	if color, ok := table["fg"].(string); ok {
+		if style.Foreground, err = parseHelixColor(palette, color); err != nil {
+			return highlight.Style{}, err
+		}
+	}
+	if color, ok := table["bg"].(string); ok {
+		if style.Background, err = parseHelixColor(palette, color); err != nil {
+			return highlight.Style{}, err
+		}
+	}
+	if _, ok = table["underline"]; ok {
+		style.Underline = true
+	}
+
+	modifiers, _ := table["modifiers"].([]any)
+	for _, modifier := range modifiers {
+		switch modifier {
+		case "bold":
+			style.Bold = true
+		case "italic":
+			style.Italic = true
+		case "underlined":
+			style.Underline = true
+		case "crossed_out":
+			style.Strikethrough = true
+		}
+	}
+
+	return style, nil
+}
+
+// parseHelixColor parses a hex color, a named terminal color or the name of a palette color.
+func parseHelixColor(palette map[string]string, color string) (highlight.Color, error) {
+	if paletteColor, ok := palette[color]; ok {
+		color = paletteColor
+	}
+	if index, ok := helixColors[color]; ok {
+		return highlight.IndexedColor(index), nil
+	}
+	if color == "default" || color == "reset" {
+		return highlight.Color{}, nil
+	}
+	return parseHexColor(color)
+}
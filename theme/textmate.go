@@ -0,0 +1,287 @@
+package theme
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"go.gopad.dev/go-tree-sitter-highlight"
+)
+
+// ScopeMapping maps a tree-sitter capture name to TextMate scopes.
+type ScopeMapping struct {
+	// Capture is the tree-sitter capture name.
+	Capture string
+	// Scopes are TextMate scopes which are typically used for the same kind of token, in order of preference.
+	Scopes []string
+}
+
+// Scopes is the table used to map the TextMate scopes of VS Code and TextMate themes to tree-sitter capture names.
+// A capture gets the style of the most specific theme rule whose selector matches the first of its scopes
+// which is matched by any rule. It can be modified before parsing themes to adjust the mapping.
+var Scopes = []ScopeMapping{
+	{Capture: "attribute", Scopes: []string{"entity.other.attribute-name"}},
+	{Capture: "boolean", Scopes: []string{"constant.language.boolean"}},
+	{Capture: "comment", Scopes: []string{"comment.line"}},
+	{Capture: "comment.documentation", Scopes: []string{"comment.block.documentation"}},
+	{Capture: "constant", Scopes: []string{"variable.other.constant", "constant.other"}},
+	{Capture: "constant.builtin", Scopes: []string{"constant.language", "support.constant"}},
+	{Capture: "constructor", Scopes: []string{"entity.name.function.constructor", "entity.name.type.class"}},
+	{Capture: "embedded", Scopes: []string{"meta.embedded"}},
+	{Capture: "error", Scopes: []string{"invalid.illegal"}},
+	{Capture: "function", Scopes: []string{"entity.name.function", "meta.function-call"}},
+	{Capture: "function.builtin", Scopes: []string{"support.function"}},
+	{Capture: "keyword", Scopes: []string{"keyword.control", "storage.type", "storage.modifier"}},
+	{Capture: "markup.bold", Scopes: []string{"markup.bold"}},
+	{Capture: "markup.heading", Scopes: []string{"markup.heading", "entity.name.section"}},
+	{Capture: "markup.italic", Scopes: []string{"markup.italic"}},
+	{Capture: "markup.link", Scopes: []string{"string.other.link", "markup.link"}},
+	{Capture: "markup.link.url", Scopes: []string{"markup.underline.link"}},
+	{Capture: "markup.list", Scopes: []string{"markup.list", "punctuation.definition.list"}},
+	{Capture: "markup.quote", Scopes: []string{"markup.quote"}},
+	{Capture: "markup.raw", Scopes: []string{"markup.raw", "markup.inline.raw", "markup.fenced_code"}},
+	{Capture: "markup.strikethrough", Scopes: []string{"markup.strikethrough"}},
+	{Capture: "module", Scopes: []string{"entity.name.namespace", "entity.name.module", "entity.name.package"}},
+	{Capture: "number", Scopes: []string{"constant.numeric"}},
+	{Capture: "operator", Scopes: []string{"keyword.operator"}},
+	{Capture: "property", Scopes: []string{"variable.other.property", "support.variable.property", "meta.object-literal.key"}},
+	{Capture: "punctuation", Scopes: []string{"punctuation"}},
+	{Capture: "punctuation.bracket", Scopes: []string{"punctuation.section.brackets", "punctuation.definition.block"}},
+	{Capture: "punctuation.delimiter", Scopes: []string{"punctuation.separator", "punctuation.terminator", "punctuation.accessor"}},
+	{Capture: "punctuation.special", Scopes: []string{"punctuation.definition.template-expression", "punctuation.section.embedded"}},
+	{Capture: "string", Scopes: []string{"string.quoted.double"}},
+	{Capture: "string.escape", Scopes: []string{"constant.character.escape"}},
+	{Capture: "string.regexp", Scopes: []string{"string.regexp"}},
+	{Capture: "string.special", Scopes: []string{"string.other", "string.unquoted"}},
+	{Capture: "string.special.symbol", Scopes: []string{"constant.other.symbol"}},
+	{Capture: "tag", Scopes: []string{"entity.name.tag"}},
+	{Capture: "type", Scopes: []string{"entity.name.type", "entity.name.class", "support.class"}},
+	{Capture: "type.builtin", Scopes: []string{"support.type", "storage.type.primitive"}},
+	{Capture: "variable", Scopes: []string{"variable.other.readwrite", "variable"}},
+	{Capture: "variable.builtin", Scopes: []string{"variable.language"}},
+	{Capture: "variable.member", Scopes: []string{"variable.other.member", "variable.other.object.property"}},
+	{Capture: "variable.parameter", Scopes: []string{"variable.parameter"}},
+}
+
+// tokenRule is a rule of a TextMate or VS Code theme which styles the tokens matching its scope selectors.
+type tokenRule struct {
+	Selectors []string
+	Style     highlight.Style
+}
+
+// textMateStyles maps the token rules to capture names using [Scopes].
+func textMateStyles(rules []tokenRule) map[string]highlight.Style {
+	styles := make(map[string]highlight.Style)
+	for _, mapping := range Scopes {
+		for _, scope := range mapping.Scopes {
+			style, ok := matchTokenRules(rules, scope)
+			if ok {
+				styles[mapping.Capture] = style
+				break
+			}
+		}
+	}
+	return styles
+}
+
+// matchTokenRules returns the style of the rule with the most specific selector matching the scope.
+// Of multiple rules with equally specific selectors, the last one wins.
+func matchTokenRules(rules []tokenRule, scope string) (highlight.Style, bool) {
+	var style highlight.Style
+	specificity := -1
+	for _, rule := range rules {
+		for _, selector := range rule.Selectors {
+			if selector != scope && !strings.HasPrefix(scope, selector+".") {
+				continue
+			}
+			if s := strings.Count(selector, ".") + 1; s >= specificity {
+				style = rule.Style
+				specificity = s
+			}
+		}
+	}
+	return style, specificity != -1
+}
+
+// parseScopeSelectors parses a comma-separated scope selector like "string, comment.line".
+// Only the last scope of descendant selectors is used and exclusions are ignored.
+func parseScopeSelectors(selector string) []string {
+	var selectors []string
+	for _, s := range strings.Split(selector, ",") {
+		s, _, _ = strings.Cut(s, " - ")
+		fields := strings.Fields(s)
+		if len(fields) == 0 {
+			continue
+		}
+		selectors = append(selectors, fields[len(fields)-1])
+	}
+	return selectors
+}
+
+// parseTokenStyle parses the foreground, background and font style of a token rule.
+func parseTokenStyle(foreground string, background string, fontStyle string) (highlight.Style, error) {
+	var style highlight.Style
+	var err error
+	if foreground != "" {
+		if style.Foreground, err = parseHexColor(foreground); err != nil {
+			return highlight.Style{}, err
+		}
+	}
+	if background != "" {
+		if style.Background, err = parseHexColor(background); err != nil {
+			return highlight.Style{}, err
+		}
+	}
+
+	for _, s := range strings.Fields(fontStyle) {
+		switch s {
+		case "bold":
+			style.Bold = true
+		case "italic":
+			style.Italic = true
+		case "underline":
+			style.Underline = true
+		case "strikethrough":
+			style.Strikethrough = true
+		}
+	}
+
+	return style, nil
+}
+
+// ParseTextMate parses a TextMate theme in the XML property list format (.tmTheme).
+// The settings without a scope are used as the default style and the scoped settings are mapped to capture names using [Scopes].
+func ParseTextMate(data []byte) (*highlight.Theme, error) {
+	value, err := decodePlist(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing textmate theme: %w", err)
+	}
+
+	root, ok := value.(map[string]any)
+	if !ok {
+		return nil, errors.New("error parsing textmate theme: root is not a dictionary")
+	}
+
+	theme := &highlight.Theme{}
+	theme.Name, _ = root["name"].(string)
+
+	settings, _ := root["settings"].([]any)
+	var rules []tokenRule
+	for _, s := range settings {
+		setting, ok := s.(map[string]any)
+		if !ok {
+			continue
+		}
+		values, _ := setting["settings"].(map[string]any)
+		foreground, _ := values["foreground"].(string)
+		background, _ := values["background"].(string)
+		fontStyle, _ := values["fontStyle"].(string)
+
+		style, err := parseTokenStyle(foreground, background, fontStyle)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing textmate theme: %w", err)
+		}
+
+		scope, _ := setting["scope"].(string)
+		if scope == "" {
+			theme.Default = style
+			continue
+		}
+		rules = append(rules, tokenRule{
+			Selectors: parseScopeSelectors(scope),
+			Style:     style,
+		})
+	}
+	theme.Styles = textMateStyles(rules)
+
+	return theme, nil
+}
+
+// decodePlist decodes an XML property list into maps, slices, strings and bools. Numbers and dates are kept as strings.
+func decodePlist(data []byte) (any, error) {
+	decoder := xml.NewDecoder(strings.NewReader(string(data)))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, errors.New("missing plist element")
+			}
+			return nil, err
+		}
+
+		if start, ok := token.(xml.StartElement); ok {
+			if start.Name.Local != "plist" {
+				return decodePlistValue(decoder, start)
+			}
+			for {
+				if token, err = decoder.Token(); err != nil {
+					return nil, err
+				}
+				if start, ok = token.(xml.StartElement); ok {
+					return decodePlistValue(decoder, start)
+				}
+			}
+		}
+	}
+}
+
+func decodePlistValue(decoder *xml.Decoder, start xml.StartElement) (any, error) {
+	switch start.Name.Local {
+	case "dict":
+		dict := make(map[string]any)
+		var key string
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := token.(type) {
+			case xml.StartElement:
+				if t.Name.Local == "key" {
+					if err = decoder.DecodeElement(&key, &t); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				value, err := decodePlistValue(decoder, t)
+				if err != nil {
+					return nil, err
+				}
+				dict[key] = value
+			case xml.EndElement:
+				return dict, nil
+			}
+		}
+	case "array":
+		var array []any
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := token.(type) {
+			case xml.StartElement:
+				value, err := decodePlistValue(decoder, t)
+				if err != nil {
+					return nil, err
+				}
+				array = append(array, value)
+			case xml.EndElement:
+				return array, nil
+			}
+		}
+	case "true", "false":
+		if err := decoder.Skip(); err != nil {
+			return nil, err
+		}
+		return start.Name.Local == "true", nil
+	default:
+		var s string
+		if err := decoder.DecodeElement(&s, &start); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+}
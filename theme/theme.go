@@ -0,0 +1,52 @@
+// Package theme imports color schemes of other editors as [highlight.Theme]s.
+//
+// Supported are Helix themes (.toml), VS Code color themes (.json), base16 schemes (.yaml) and TextMate themes (.tmTheme).
+// Helix themes already use tree-sitter capture names, the scopes of VS Code and TextMate themes are mapped to capture
+// names using [Scopes].
+package theme
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go.gopad.dev/go-tree-sitter-highlight"
+)
+
+// Parse parses a theme in the format matching the extension of the file name.
+func Parse(fileName string, data []byte) (*highlight.Theme, error) {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".toml":
+		return ParseHelix(data)
+	case ".json":
+		return ParseVSCode(data)
+	case ".yaml", ".yml":
+		return ParseBase16(data)
+	case ".tmtheme":
+		return ParseTextMate(data)
+	default:
+		return nil, fmt.Errorf("unknown theme format %q", filepath.Ext(fileName))
+	}
+}
+
+// parseHexColor parses a color in the form "#rgb", "#rgba", "#rrggbb" or "#rrggbbaa". The alpha channel is ignored.
+// The leading # is optional.
+func parseHexColor(s string) (highlight.Color, error) {
+	hex := strings.TrimPrefix(s, "#")
+	switch len(hex) {
+	case 3, 4:
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	case 6:
+	case 8:
+		hex = hex[:6]
+	default:
+		return highlight.Color{}, fmt.Errorf("invalid color %q", s)
+	}
+
+	rgb, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return highlight.Color{}, fmt.Errorf("invalid color %q: %w", s, err)
+	}
+	return highlight.RGBColor(uint8(rgb>>16), uint8(rgb>>8), uint8(rgb)), nil
+}
@@ -0,0 +1,174 @@
+package theme
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.gopad.dev/go-tree-sitter-highlight"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// formatStyle formats a style like "fg=#ff0000 bold".
+func formatStyle(style highlight.Style) string {
+	var parts []string
+	if style.Foreground.IsSet() {
+		parts = append(parts, "fg="+style.Foreground.String())
+	}
+	if style.Background.IsSet() {
+		parts = append(parts, "bg="+style.Background.String())
+	}
+	for _, attribute := range []struct {
+		name string
+		set  bool
+	}{
+		{"bold", style.Bold},
+		{"italic", style.Italic},
+		{"underline", style.Underline},
+		{"strikethrough", style.Strikethrough},
+	} {
+		if attribute.set {
+			parts = append(parts, attribute.name)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatTheme formats a theme with one sorted line per style.
+func formatTheme(theme *highlight.Theme) string {
+	var b strings.Builder
+	b.WriteString("name: " + theme.Name + "\n")
+	b.WriteString("default: " + formatStyle(theme.Default) + "\n")
+	for _, name := range theme.Names() {
+		b.WriteString(name + ": " + formatStyle(theme.Styles[name]) + "\n")
+	}
+	return b.String()
+}
+
+func TestParse_Golden(t *testing.T) {
+	files := []string{
+		"dracula.toml",
+		"dark_plus.json",
+		"tomorrow-night.yaml",
+		"gruvbox-dark-hard.yaml",
+		"monokai.tmTheme",
+	}
+
+	for _, file := range files {
+		t.Run(file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", file))
+			require.NoError(t, err)
+
+			theme, err := Parse(file, data)
+			require.NoError(t, err)
+			actual := formatTheme(theme)
+
+			golden := filepath.Join("testdata", file+".golden")
+			if *update {
+				require.NoError(t, os.WriteFile(golden, []byte(actual), 0o644))
+			}
+
+			expected, err := os.ReadFile(golden)
+			require.NoError(t, err)
+			assert.Equal(t, string(expected), actual)
+		})
+	}
+}
+
+func TestParse_UnknownFormat(t *testing.T) {
+	_, err := Parse("theme.xml", nil)
+	assert.Error(t, err)
+}
+
+func TestParseHelix(t *testing.T) {
+	theme, err := ParseHelix([]byte(`
+inherits = "onedark"
+"ui.text" = "white"
+keyword = { fg = "red", bg = "#123", modifiers = ["bold", "underlined"] }
+string = "default"
+markup.heading = { fg = "blue" }
+markup.list = "gray"
+
+[palette]
+red = "#ff0000"
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, highlight.Style{Foreground: highlight.IndexedColor(15)}, theme.Default)
+	assert.Equal(t, map[string]highlight.Style{
+		"keyword":        {Foreground: highlight.RGBColor(0xff, 0, 0), Background: highlight.RGBColor(0x11, 0x22, 0x33), Bold: true, Underline: true},
+		"string":         {},
+		"markup.heading": {Foreground: highlight.IndexedColor(4)},
+		"markup.list":    {Foreground: highlight.IndexedColor(8)},
+	}, theme.Styles)
+
+	_, err = ParseHelix([]byte(`keyword = "nope"`))
+	assert.Error(t, err)
+}
+
+func TestParseVSCode(t *testing.T) {
+	theme, err := ParseVSCode([]byte(`{
+	// comment with "quotes", and a comma,
+	"name": "test // not a comment",
+	"tokenColors": [
+		{ "settings": { "foreground": "#112233", "background": "#445566" } },
+		{ "scope": "keyword, storage.type - meta.foo", "settings": { "foreground": "#ff0000aa", "fontStyle": "bold italic" } },
+		{ "scope": ["source.go keyword.control"], "settings": { "foreground": "#00ff00" } },
+	],
+}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, "test // not a comment", theme.Name)
+	assert.Equal(t, highlight.Style{Foreground: highlight.RGBColor(0x11, 0x22, 0x33), Background: highlight.RGBColor(0x44, 0x55, 0x66)}, theme.Default)
+	assert.Equal(t, map[string]highlight.Style{
+		"keyword":      {Foreground: highlight.RGBColor(0, 0xff, 0)},
+		"operator":     {Foreground: highlight.RGBColor(0xff, 0, 0), Bold: true, Italic: true},
+		"type.builtin": {Foreground: highlight.RGBColor(0xff, 0, 0), Bold: true, Italic: true},
+	}, theme.Styles)
+}
+
+func TestParseBase16_MissingColor(t *testing.T) {
+	_, err := ParseBase16([]byte("scheme: broken\nbase00: \"000000\"\n"))
+	assert.Error(t, err)
+}
+
+func TestMatchTokenRules(t *testing.T) {
+	rules := []tokenRule{
+		{Selectors: []string{"string"}, Style: highlight.Style{Bold: true}},
+		{Selectors: []string{"string.quoted"}, Style: highlight.Style{Italic: true}},
+		{Selectors: []string{"string"}, Style: highlight.Style{Underline: true}},
+		{Selectors: []string{"str"}, Style: highlight.Style{Strikethrough: true}},
+	}
+
+	tests := []struct {
+		scope    string
+		expected *highlight.Style
+	}{
+		{scope: "string.quoted.double", expected: &highlight.Style{Italic: true}},
+		{scope: "string.regexp", expected: &highlight.Style{Underline: true}},
+		{scope: "string", expected: &highlight.Style{Underline: true}},
+		{scope: "strong", expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scope, func(t *testing.T) {
+			style, ok := matchTokenRules(rules, tt.scope)
+			assert.Equal(t, tt.expected != nil, ok)
+			if tt.expected != nil {
+				assert.Equal(t, *tt.expected, style)
+			}
+		})
+	}
+
+	// every capture of the mapping table is a standard capture name
+	for _, mapping := range Scopes {
+		assert.True(t, slices.Contains(highlight.StandardCaptureNames, mapping.Capture), mapping.Capture)
+	}
+}
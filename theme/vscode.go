@@ -0,0 +1,130 @@
+package theme
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.gopad.dev/go-tree-sitter-highlight"
+)
+
+type vsCodeTheme struct {
+	Name        string            `json:"name"`
+	Colors      map[string]string `json:"colors"`
+	TokenColors []vsCodeTokenRule `json:"tokenColors"`
+}
+
+type vsCodeTokenRule struct {
+	Scope    vsCodeScope `json:"scope"`
+	Settings struct {
+		Foreground string `json:"foreground"`
+		Background string `json:"background"`
+		FontStyle  string `json:"fontStyle"`
+	} `json:"settings"`
+}
+
+// vsCodeScope is the scope of a token rule which is either a comma-separated string or an array of selectors.
+type vsCodeScope []string
+
+func (s *vsCodeScope) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*s = parseScopeSelectors(single)
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*s = nil
+	for _, selector := range multiple {
+		*s = append(*s, parseScopeSelectors(selector)...)
+	}
+	return nil
+}
+
+// ParseVSCode parses a VS Code color theme. Comments and trailing commas are allowed like in VS Code.
+// The editor.foreground and editor.background colors are used as the default style and the tokenColors are mapped to
+// capture names using [Scopes]. Themes which include another theme only contain their own token colors.
+func ParseVSCode(data []byte) (*highlight.Theme, error) {
+	var vsTheme vsCodeTheme
+	if err := json.Unmarshal(stripJSONC(data), &vsTheme); err != nil {
+		return nil, fmt.Errorf("error parsing vs code theme: %w", err)
+	}
+
+	defaultStyle, err := parseTokenStyle(vsTheme.Colors["editor.foreground"], vsTheme.Colors["editor.background"], "")
+	if err != nil {
+		return nil, fmt.Errorf("error parsing vs code theme: %w", err)
+	}
+
+	var rules []tokenRule
+	for _, rule := range vsTheme.TokenColors {
+		style, err := parseTokenStyle(rule.Settings.Foreground, rule.Settings.Background, rule.Settings.FontStyle)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing vs code theme: %w", err)
+		}
+
+		// a rule without a scope sets the default style like in TextMate themes
+		if len(rule.Scope) == 0 {
+			defaultStyle = style.Inherit(defaultStyle)
+			continue
+		}
+		rules = append(rules, tokenRule{
+			Selectors: rule.Scope,
+			Style:     style,
+		})
+	}
+
+	return &highlight.Theme{
+		Name:    vsTheme.Name,
+		Default: defaultStyle,
+		Styles:  textMateStyles(rules),
+	}, nil
+}
+
+// stripJSONC removes the comments and trailing commas of JSON with comments.
+func stripJSONC(data []byte) []byte {
+	result := make([]byte, 0, len(data))
+	// pendingComma is the index of a comma in the result which is removed if the next token closes an object or array
+	pendingComma := -1
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == '"':
+			start := i
+			for i++; i < len(data) && data[i] != '"'; i++ {
+				if data[i] == '\\' {
+					i++
+				}
+			}
+			result = append(result, data[start:min(i+1, len(data))]...)
+			pendingComma = -1
+		case c == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+			i--
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			i += 2
+			for i+1 < len(data) && !(data[i] == '*' && data[i+1] == '/') {
+				i++
+			}
+			i++
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			result = append(result, c)
+		case c == ',':
+			pendingComma = len(result)
+			result = append(result, c)
+		case c == '}' || c == ']':
+			if pendingComma != -1 {
+				result[pendingComma] = ' '
+			}
+			result = append(result, c)
+			pendingComma = -1
+		default:
+			result = append(result, c)
+			pendingComma = -1
+		}
+	}
+	return result
+}
@@ -0,0 +1,92 @@
+package highlight
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testTheme = &Theme{
+	Name:    "test",
+	Default: Style{Foreground: RGBColor(0xee, 0xee, 0xee), Background: RGBColor(0x11, 0x11, 0x11)},
+	Styles: map[string]Style{
+		"keyword":          {Foreground: RGBColor(0xa5, 0x78, 0xea), Bold: true},
+		"function":         {Foreground: RGBColor(0x73, 0xfb, 0xf1)},
+		"function.builtin": {Foreground: RGBColor(0x73, 0xfb, 0xf1), Italic: true},
+		"string":           {Foreground: RGBColor(0xb8, 0xe4, 0x66)},
+	},
+	Languages: map[string]map[string]Style{
+		"go": {
+			"function":        {Foreground: RGBColor(0xff, 0x00, 0x00)},
+			"string.escape":   {Foreground: RGBColor(0x00, 0xff, 0x00)},
+			"type.definition": {Underline: true},
+		},
+	},
+}
+
+func TestTheme_Names(t *testing.T) {
+	assert.Equal(t, []string{"function", "function.builtin", "keyword", "string", "string.escape", "type.definition"}, testTheme.Names())
+}
+
+func TestTheme_Resolve(t *testing.T) {
+	tests := []struct {
+		name        string
+		captureName string
+		language    string
+		expected    *Style
+	}{
+		{name: "exact", captureName: "keyword", language: "javascript", expected: &Style{Foreground: RGBColor(0xa5, 0x78, 0xea), Bold: true}},
+		{name: "fallback", captureName: "keyword.return", language: "javascript", expected: &Style{Foreground: RGBColor(0xa5, 0x78, 0xea), Bold: true}},
+		{name: "most specific", captureName: "function.builtin.static", language: "javascript", expected: &Style{Foreground: RGBColor(0x73, 0xfb, 0xf1), Italic: true}},
+		{name: "language override", captureName: "function.method", language: "go", expected: &Style{Foreground: RGBColor(0xff, 0x00, 0x00)}},
+		{name: "general style more specific than override", captureName: "function.builtin", language: "go", expected: &Style{Foreground: RGBColor(0x73, 0xfb, 0xf1), Italic: true}},
+		{name: "language only", captureName: "string.escape", language: "go", expected: &Style{Foreground: RGBColor(0x00, 0xff, 0x00)}},
+		{name: "language only in other language", captureName: "string.escape", language: "javascript", expected: &Style{Foreground: RGBColor(0xb8, 0xe4, 0x66)}},
+		{name: "unknown", captureName: "type.definition", language: "javascript", expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			style, ok := testTheme.Resolve(tt.captureName, tt.language)
+			if tt.expected == nil {
+				assert.False(t, ok)
+				return
+			}
+			assert.True(t, ok)
+			assert.Equal(t, *tt.expected, style)
+		})
+	}
+}
+
+func TestTheme_StyleCallback(t *testing.T) {
+	captureNames := testTheme.Names()
+	callback := testTheme.StyleCallback(captureNames)
+
+	assert.Equal(t, testTheme.Default, callback(DefaultHighlight, "go"))
+	assert.Equal(t, testTheme.Languages["go"]["function"], callback(0, "go"))
+	assert.Equal(t, testTheme.Styles["function"], callback(0, "javascript"))
+	assert.Equal(t, Style{}, callback(5, "javascript"))
+	assert.Equal(t, Style{}, callback(Highlight(len(captureNames)), "go"))
+}
+
+func TestTheme_Configure(t *testing.T) {
+	source := []byte("package main\n\nfunc main() {\n\tprintln(\"hello\\n\")\n}\n")
+
+	cfg := loadTestConfiguration(t, "go")
+	cfg.Configure(testTheme.Names())
+
+	var buf bytes.Buffer
+	events := New().Highlight(context.Background(), *cfg, source, nil)
+	err := NewTerminalRender(ColorModeTrueColor).Render(&buf, events, source, testTheme.StyleCallback(testTheme.Names()))
+	require.NoError(t, err)
+
+	// the theme's default style is used for text without highlight
+	assert.Contains(t, buf.String(), "\x1b[38;2;238;238;238;48;2;17;17;17m")
+	// keywords are bold
+	assert.Contains(t, buf.String(), "\x1b[1;38;2;165;120;234;48;2;17;17;17mpackage")
+	// go strings escapes use the language specific style
+	assert.Contains(t, buf.String(), "\x1b[38;2;0;255;0;48;2;17;17;17m\\n")
+}